@@ -0,0 +1,265 @@
+package packer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// ErrInvalidAnimation is an error thrown when the animation chunks are broken
+var ErrInvalidAnimation = errors.New("Invalid animation provided")
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// AddAnimation adds the GIF or APNG frames as the images name_000, name_001...
+// with their durations, other images are added as the single frame
+func (p *Packer) AddAnimation(r io.Reader, name string) ([]*InputImage, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var frames []image.Image
+	var delays []time.Duration
+
+	switch {
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		frames, delays, err = decodeGIF(data)
+	case bytes.HasPrefix(data, pngSignature):
+		frames, delays, err = decodeAPNG(data)
+	default:
+		var img image.Image
+		img, _, err = image.Decode(bytes.NewReader(data))
+		frames, delays = []image.Image{img}, []time.Duration{0}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]*InputImage, len(frames))
+	for i, frame := range frames {
+		if images[i], err = p.newInputImage(frame, 0); err != nil {
+			return nil, err
+		}
+		images[i].Name = fmt.Sprintf("%s_%03d", name, i)
+		images[i].Duration = delays[i]
+	}
+
+	p.appendImage(images...)
+	return images, nil
+}
+
+func decodeGIF(data []byte) ([]image.Image, []time.Duration, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	var frames []image.Image
+	var delays []time.Duration
+
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+
+		var previous *image.NRGBA
+		if disposal == gif.DisposalPrevious {
+			previous = cloneNRGBA(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		frames = append(frames, cloneNRGBA(canvas))
+		delays = append(delays, time.Duration(g.Delay[i])*10*time.Millisecond)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.ZP, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	return frames, delays, nil
+}
+
+// the APNG dispose_op and blend_op values
+const (
+	apngDisposeNone = iota
+	apngDisposeBackground
+	apngDisposePrevious
+)
+
+const apngBlendOver = 1
+
+// apngFrame is the APNG frame control with its data
+type apngFrame struct {
+	rect    image.Rectangle
+	delay   time.Duration
+	dispose byte
+	blend   byte
+	data    [][]byte
+}
+
+// decodeAPNG decodes the APNG frames as the standalone PNG images, the PNG
+// without the animation control is the single frame
+func decodeAPNG(data []byte) ([]image.Image, []time.Duration, error) {
+	var ihdr []byte
+	var shared [][]byte
+	var animated bool
+	var control []*apngFrame
+	var idat [][]byte
+
+	for rest := data[len(pngSignature):]; len(rest) >= 12; {
+		length := int(binary.BigEndian.Uint32(rest))
+		if 12+length > len(rest) {
+			return nil, nil, ErrInvalidAnimation
+		}
+		typ, body := string(rest[4:8]), rest[8:8+length]
+		chunk := rest[:12+length]
+		rest = rest[12+length:]
+
+		switch typ {
+		case "IHDR":
+			ihdr = body
+		case "acTL":
+			animated = true
+		case "fcTL":
+			if length < 26 {
+				return nil, nil, ErrInvalidAnimation
+			}
+			num, den := binary.BigEndian.Uint16(body[20:]), binary.BigEndian.Uint16(body[22:])
+			if den == 0 {
+				den = 100
+			}
+			x, y := int(binary.BigEndian.Uint32(body[12:])), int(binary.BigEndian.Uint32(body[16:]))
+			w, h := int(binary.BigEndian.Uint32(body[4:])), int(binary.BigEndian.Uint32(body[8:]))
+			control = append(control, &apngFrame{
+				rect:    image.Rect(x, y, x+w, y+h),
+				delay:   time.Duration(num) * time.Second / time.Duration(den),
+				dispose: body[24],
+				blend:   body[25],
+			})
+		case "IDAT":
+			idat = append(idat, body)
+			// the default image is the first frame when its control precedes it
+			if len(control) == 1 {
+				control[0].data = append(control[0].data, body)
+			}
+		case "fdAT":
+			if length < 4 || len(control) == 0 {
+				return nil, nil, ErrInvalidAnimation
+			}
+			last := control[len(control)-1]
+			last.data = append(last.data, body[4:])
+		case "IEND":
+		default:
+			if len(idat) == 0 {
+				shared = append(shared, chunk)
+			}
+		}
+	}
+
+	if len(ihdr) < 13 {
+		return nil, nil, ErrInvalidAnimation
+	}
+
+	if !animated || len(control) == 0 {
+		img, err := png.Decode(bytes.NewReader(data))
+		return []image.Image{img}, []time.Duration{0}, err
+	}
+
+	w, h := int(binary.BigEndian.Uint32(ihdr)), int(binary.BigEndian.Uint32(ihdr[4:]))
+	canvas := image.NewNRGBA(image.Rect(0, 0, w, h))
+	var frames []image.Image
+	var delays []time.Duration
+
+	for i, c := range control {
+		if len(c.data) == 0 {
+			return nil, nil, ErrInvalidAnimation
+		}
+		frame, err := png.Decode(bytes.NewReader(encodeAPNGFrame(ihdr, shared, c)))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		dispose := c.dispose
+		if i == 0 && dispose == apngDisposePrevious {
+			dispose = apngDisposeBackground
+		}
+		var previous *image.NRGBA
+		if dispose == apngDisposePrevious {
+			previous = cloneNRGBA(canvas)
+		}
+
+		op := draw.Src
+		if c.blend == apngBlendOver {
+			op = draw.Over
+		}
+		draw.Draw(canvas, c.rect, frame, frame.Bounds().Min, op)
+		frames = append(frames, cloneNRGBA(canvas))
+		delays = append(delays, c.delay)
+
+		switch dispose {
+		case apngDisposeBackground:
+			draw.Draw(canvas, c.rect, image.Transparent, image.ZP, draw.Src)
+		case apngDisposePrevious:
+			canvas = previous
+		}
+	}
+
+	return frames, delays, nil
+}
+
+// encodeAPNGFrame encodes the frame as the standalone PNG
+func encodeAPNGFrame(ihdr []byte, shared [][]byte, c *apngFrame) []byte {
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+
+	header := append([]byte{}, ihdr...)
+	binary.BigEndian.PutUint32(header, uint32(c.rect.Dx()))
+	binary.BigEndian.PutUint32(header[4:], uint32(c.rect.Dy()))
+	writePNGChunk(&buf, "IHDR", header)
+
+	for _, chunk := range shared {
+		buf.Write(chunk)
+	}
+	for _, data := range c.data {
+		writePNGChunk(&buf, "IDAT", data)
+	}
+	writePNGChunk(&buf, "IEND", nil)
+
+	return buf.Bytes()
+}
+
+func writePNGChunk(w io.Writer, typ string, data []byte) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(len(data)))
+	w.Write(b[:])
+
+	crc := crc32.NewIEEE()
+	io.WriteString(crc, typ)
+	crc.Write(data)
+
+	io.WriteString(w, typ)
+	w.Write(data)
+	binary.BigEndian.PutUint32(b[:], crc.Sum32())
+	w.Write(b[:])
+}
+
+func cloneNRGBA(img *image.NRGBA) *image.NRGBA {
+	c := image.NewNRGBA(img.Bounds())
+	copy(c.Pix, img.Pix)
+	return c
+}
@@ -1,5 +1,11 @@
 package packer
 
+import (
+	"github.com/disintegration/imaging"
+	"image/color"
+	"time"
+)
+
 // Config is the packer configuration
 type Config struct {
 	SortOrder         SortOrder
@@ -8,7 +14,7 @@ type Config struct {
 	Merge             bool
 	Crop              bool
 	Square            bool
-	Rotate            bool
+	Rotation          Rotation
 	Border            int
 	Extrude           int
 	AutoGrow          bool
@@ -18,6 +24,100 @@ type Config struct {
 	MinTextureSizeX   int
 	MinTextureSizeY   int
 	Heuristic         Heuristic
+
+	// TrimMode selects the trimming
+	TrimMode TrimMode
+	// TrimColor is the TrimColorKey color, nil uses the top left pixel
+	TrimColor color.Color
+	// TrimTolerance is the maximum channel difference (0-255) from the TrimColor
+	TrimTolerance int
+	// TrimMargin is the margin kept around the trimmed area
+	TrimMargin int
+
+	// Dedup selects the duplicate detection of the Merge
+	Dedup DedupMode
+	// DedupTolerance is the maximum channel difference (0-255) of the
+	// DedupTolerance mode
+	DedupTolerance int
+	// DedupDistance is the maximum hash distance (0-64) of the DedupPerceptual
+	// mode
+	DedupDistance int
+	// DedupTransforms merges the flipped and rotated duplicates, the libGDX
+	// atlas has no transforms
+	DedupTransforms bool
+
+	// Scales lists the scales of the extra atlas sets, see the Variant. The
+	// sizes are rounded up and the Border and Extrude are kept in pixels.
+	Scales []float64
+	// ScaleFilter is the Scales resampling filter
+	ScaleFilter imaging.ResampleFilter
+
+	// SizePolicy constrains the bin sizes
+	SizePolicy SizePolicy
+	// SizeMultiple is the SizeMultiple policy multiple
+	SizeMultiple int
+	// Alignment aligns the placed images, 4 keeps the sprites in their own
+	// BCn or ETC blocks
+	Alignment int
+
+	// ShrinkToFit refits the last bin and shrinks the bins to their images
+	ShrinkToFit bool
+
+	// MaxTextureWidth and MaxTextureHeight cap the bin sizes, zero is unlimited
+	MaxTextureWidth  int
+	MaxTextureHeight int
+	// SpillPages adds the pages when the AutoGrow reaches the maximum size,
+	// otherwise the Pack fails with the ErrMaxSizeExceeded
+	SpillPages bool
+
+	// Strict fails the Pack with the *UnplacedError on the unplaced images
+	Strict bool
+
+	// MaxPages limits the page count, zero is unlimited
+	MaxPages int
+	// Overflow selects the MaxPages overflow handling
+	Overflow OverflowPolicy
+	// MinDownscale is the smallest OverflowDownscale scale
+	MinDownscale float64
+
+	// Workers is the AddImages goroutine count, zero is one per CPU
+	Workers int
+
+	// KeepExtension keeps the file extensions in the image names
+	KeepExtension bool
+	// PathSeparator joins the image name directories, empty is the slash
+	PathSeparator string
+
+	// SequencePattern matches the animation frame names by the name and
+	// number groups, empty disables the animations, see the
+	// DefaultSequencePattern
+	SequencePattern string
+	// FrameDuration is the default frame duration
+	FrameDuration time.Duration
+
+	// Mesh traces the sprite meshes
+	Mesh MeshMode
+	// MeshVertices is the maximum mesh vertex count, at least 4
+	MeshVertices int
+
+	// Packing selects the placement, the PackMasks ignores the Heuristic and
+	// the rotation
+	Packing PackingMode
+	// MaskGap is the minimum PackMasks gap
+	MaskGap int
+
+	// RotationDirection is the rotation direction, the WriteJSON reads the
+	// RotateCW and the WriteLibGDX the RotateCCW pages
+	RotationDirection RotationDirection
+
+	// Quantize quantizes the OutputImages to the PaletteSize colors
+	Quantize QuantizeMode
+	// PaletteSize is the palette size, from 2 to 256
+	PaletteSize int
+	// SharedPalette uses one palette for all the pages and Variants
+	SharedPalette bool
+	// Dither enables the Floyd-Steinberg dithering
+	Dither bool
 }
 
 // DefaultConfig returns the default config for the packer
@@ -29,7 +129,7 @@ func DefaultConfig() *Config {
 		Crop:              true,
 		Border:            0,
 		Extrude:           0,
-		Rotate:            false,
+		Rotation:          RNever,
 		Square:            true,
 		AutoGrow:          false,
 		Autosize:          true,
@@ -39,5 +139,19 @@ func DefaultConfig() *Config {
 		MinTextureSizeX:   32,
 		MinTextureSizeY:   32,
 		Heuristic:         HTl,
+		TrimMode:          TrimAlpha,
+		Dedup:             DedupExact,
+		ScaleFilter:       imaging.Lanczos,
+		SizePolicy:        SizeAny,
+		Strict:            false,
+		Overflow:          OverflowFail,
+		MinDownscale:      0.25,
+		FrameDuration:     100 * time.Millisecond,
+		Mesh:              MeshNone,
+		MeshVertices:      8,
+		Packing:           PackRects,
+		RotationDirection: RotateCCW,
+		Quantize:          QuantizeNone,
+		PaletteSize:       256,
 	}
 }
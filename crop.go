@@ -2,109 +2,91 @@ package packer
 
 import (
 	"image"
+	"image/color"
 )
 
+// Trim holds the pixels trimmed from each edge
+type Trim struct {
+	Left, Top, Right, Bottom int
+}
+
+// crop returns the kept region grown by the TrimMargin
 func (p *Packer) crop(img image.Image) image.Rectangle {
+	b := img.Bounds()
+	keep := p.trimFunc(img)
+	rows := newRowReader(img)
+	w := b.Dx()
 
-	var j, w, h, x, y int
-	// var pix color.RGBA
-	var breakB bool
+	top, bottom := -1, -1
+	left, right := w, 0
 
-	var t = true
-	cmpf1 := func(x, y, a int) bool {
-		temp := img.At(x, y)
-		_, _, _, tempA := temp.RGBA()
-		return int(tempA) > a
-	}
-	cmp := func(x, y, a int) {
-		if cmpf1(x, y, a) {
-			t = false
-			breakB = true
-		} else {
-			if !t {
-				breakB = true
-			}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := rows.row(y)
+
+		l := 0
+		for l < w && !keep(row[4*l:4*l+4]) {
+			l++
+		}
+		if l == w {
+			continue
 		}
-	}
 
-	// cmpf2 := func(x, y int) bool {
-	// 	temp := img.At(x, y)
-	// 	r, g, b, a := temp.RGBA()
-	// 	r1, g1, b1, a1 := pix.RGBA()
-	// 	return r != r1 || g != g1 || b != b1 || a != a1
-	// }
-
-	// cmp2 := func(x, y int) {
-	// 	if cmpf2(x, y) {
-	// 		t = false
-	// 		breakB = true
-	// 	} else {
-	// 		if !t {
-	// 			breakB = true
-	// 		}
-	// 	}
-	// }
-
-yl:
-	for y = 0; y < img.Bounds().Dy(); y++ {
-		for j := 0; j < img.Bounds().Dx(); j++ {
-			cmp(j, y, p.cropThreshold)
-			if breakB {
-				breakB = false
-				break yl
-			}
+		r := w
+		for r > l && !keep(row[4*r-4:4*r]) {
+			r--
 		}
-	}
 
-	t = true
-xl:
-	for x = 0; x < img.Bounds().Dx(); x++ {
-		for j := y; j < img.Bounds().Dy(); j++ {
-			cmp(x, j, p.cropThreshold)
-			if breakB {
-				breakB = false
-				break xl
-			}
+		if top < 0 {
+			top = y
 		}
+		bottom = y + 1
+		left = min(left, l)
+		right = max(right, r)
 	}
 
-	t = true
-wl:
-	for w = img.Bounds().Dx(); w > 0; w-- {
-		for j = y; j < img.Bounds().Dy(); j++ {
-			cmp(w-1, j, p.cropThreshold)
-			if breakB {
-				breakB = false
-				break wl
-			}
-		}
+	// the whole image is trimmed away
+	if top < 0 {
+		return image.Rectangle{b.Min, b.Min}
 	}
 
-	t = true
-hl:
-	for h = img.Bounds().Dy(); h > 0; h-- {
-		for j = x; j < w; j++ {
-			cmp(j, h-1, p.cropThreshold)
-			if breakB {
-				breakB = false
-				break hl
-			}
-		}
+	r := image.Rect(b.Min.X+left, top, b.Min.X+right, bottom)
+	if p.cfg.TrimMargin > 0 {
+		r = r.Inset(-p.cfg.TrimMargin).Intersect(b)
 	}
 
-	w = w - x
-	h = h - y
-	if w < 0 {
-		w = 0
+	return r
+}
+
+// trimFunc returns the function reporting the kept pixels
+func (p *Packer) trimFunc(img image.Image) func(px []byte) bool {
+	threshold := uint32(p.cfg.CropThreshold)
+
+	if p.cfg.TrimMode != TrimColorKey {
+		return func(px []byte) bool {
+			return uint32(px[3])*0x101 > threshold
+		}
 	}
 
-	if h < 0 {
-		h = 0
+	key := p.cfg.TrimColor
+	if key == nil {
+		// the background color is taken from the top left corner
+		key = img.At(img.Bounds().Min.X, img.Bounds().Min.Y)
 	}
-	// b := img.Bounds()
-	// fmt.Printf("Original: %d, %d, %d, %d\n", b.Min.X, b.Min.Y, b.Max.X, b.Max.Y)
-	// fmt.Printf("Cropped: %d, %d, %d, %d\n", x, y, w, h)
+	k := color.NRGBAModel.Convert(key).(color.NRGBA)
+	tolerance := uint8(min(p.cfg.TrimTolerance, 0xff))
 
-	return image.Rectangle{image.Pt(x, y), image.Pt(x+w, y+h)}
+	return func(px []byte) bool {
+		if uint32(px[3])*0x101 <= threshold {
+			return false
+		}
+		return diff(px[0], k.R) > tolerance || diff(px[1], k.G) > tolerance ||
+			diff(px[2], k.B) > tolerance || diff(px[3], k.A) > tolerance
+	}
+}
 
+func diff(i, j uint8) uint8 {
+	if i > j {
+		return i - j
+	}
+	return j - i
 }
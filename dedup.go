@@ -0,0 +1,133 @@
+package packer
+
+import (
+	"github.com/disintegration/imaging"
+	"image"
+	"math/bits"
+)
+
+// nearDuplicates finds the similar images for the DedupTolerance and
+// DedupPerceptual modes
+type nearDuplicates struct {
+	p *Packer
+
+	// bySize holds the stored images by the size of their content,
+	// only the images with the same content size can share the region
+	bySize map[image.Point][]*InputImage
+	phash  map[*InputImage]uint64
+}
+
+func (p *Packer) newNearDuplicates() *nearDuplicates {
+	return &nearDuplicates{
+		p:      p,
+		bySize: map[image.Point][]*InputImage{},
+		phash:  map[*InputImage]uint64{},
+	}
+}
+
+// content gets the compared region
+func (n *nearDuplicates) content(i *InputImage) image.Rectangle {
+	if n.p.cfg.Crop {
+		return i.crop
+	}
+	return i.size
+}
+
+func (n *nearDuplicates) add(i *InputImage) {
+	size := n.content(i).Size()
+	n.bySize[size] = append(n.bySize[size], i)
+}
+
+// find finds the closest image within the tolerance, nil when none
+func (n *nearDuplicates) find(i *InputImage) (dup *InputImage, maxErr, distance int) {
+	r := n.content(i)
+	if r.Empty() {
+		return nil, 0, 0
+	}
+
+	switch n.p.cfg.Dedup {
+	case DedupTolerance:
+		best := n.p.cfg.DedupTolerance
+		for _, s := range n.bySize[r.Size()] {
+			if e, ok := maxDiff(s.image, n.content(s), i.image, r, best); ok && (dup == nil || e < maxErr) {
+				dup, maxErr = s, e
+			}
+		}
+		return dup, maxErr, 0
+
+	case DedupPerceptual:
+		h := n.hash(i)
+		best := n.p.cfg.DedupDistance
+		for _, s := range n.bySize[r.Size()] {
+			if d := bits.OnesCount64(h ^ n.hash(s)); d <= best && (dup == nil || d < distance) {
+				dup, distance = s, d
+			}
+		}
+		if dup != nil {
+			maxErr, _ = maxDiff(dup.image, n.content(dup), i.image, r, 0xff)
+		}
+		return dup, maxErr, distance
+	}
+
+	return nil, 0, 0
+}
+
+func (n *nearDuplicates) hash(i *InputImage) uint64 {
+	h, ok := n.phash[i]
+	if !ok {
+		h = perceptualHash(i.image, n.content(i))
+		n.phash[i] = h
+	}
+	return h
+}
+
+// maxDiff computes the maximum channel difference of the regions, it stops
+// at the limit and ignores the color of the transparent pixels
+func maxDiff(i image.Image, ri image.Rectangle, j image.Image, rj image.Rectangle, limit int) (int, bool) {
+	rowsI, rowsJ := newRowReader(i), newRowReader(j)
+	oi, oj := 4*(ri.Min.X-i.Bounds().Min.X), 4*(rj.Min.X-j.Bounds().Min.X)
+	w := 4 * ri.Dx()
+
+	var m uint8
+	for y := 0; y < ri.Dy(); y++ {
+		pi := rowsI.row(ri.Min.Y + y)[oi : oi+w]
+		pj := rowsJ.row(rj.Min.Y + y)[oj : oj+w]
+
+		for x := 0; x < w; x += 4 {
+			if pi[x+3] == 0 && pj[x+3] == 0 {
+				continue
+			}
+			for c := x; c < x+4; c++ {
+				if d := diff(pi[c], pj[c]); d > m {
+					m = d
+				}
+			}
+		}
+		if int(m) > limit {
+			return int(m), false
+		}
+	}
+
+	return int(m), true
+}
+
+// perceptualHash computes the 9x8 difference hash of the region
+func perceptualHash(img image.Image, r image.Rectangle) uint64 {
+	small := imaging.Resize(imaging.Crop(img, r), 9, 8, imaging.Box)
+
+	luma := func(x, y int) int {
+		c := small.NRGBAAt(x, y)
+		return (299*int(c.R) + 587*int(c.G) + 114*int(c.B)) * int(c.A) / 0xff
+	}
+
+	var h uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if luma(x, y) < luma(x+1, y) {
+				h |= 1 << uint(8*y+x)
+			}
+		}
+	}
+
+	return h
+}
@@ -1,5 +1,7 @@
 package packer
 
+import "fmt"
+
 // SortOrder is the enum that defines sorting order for the packer
 type SortOrder int
 
@@ -24,7 +26,8 @@ const (
 	HMinh
 )
 
-// Rotation defines the enums for the rotation
+// Rotation defines the enums for the rotation, the rules other than RNever
+// and ROnlyWhenNeeded rotate the matching images first
 type Rotation int
 
 const (
@@ -36,4 +39,187 @@ const (
 	RW2HeightW
 	RHeightGreaterWidth
 	RHeightGreater2Width
+	// RBestFit rotates the images whenever the heuristic scores the rotated
+	// placement better
+	RBestFit
+)
+
+// RotationDirection defines the enum for the rotation direction
+type RotationDirection int
+
+const (
+	// RotateCCW rotates the images by 90 degrees counterclockwise as the libGDX
+	RotateCCW RotationDirection = iota
+	// RotateCW rotates the images by 90 degrees clockwise as the TexturePacker
+	RotateCW
+)
+
+var rotationDirections = []string{"ccw", "cw"}
+
+func (d RotationDirection) String() string {
+	if d < 0 || int(d) >= len(rotationDirections) {
+		return "unknown"
+	}
+	return rotationDirections[d]
+}
+
+// MarshalText encodes the direction by its name
+func (d RotationDirection) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// TrimMode defines the enum for the trimming
+type TrimMode int
+
+const (
+	// TrimAlpha trims the pixels with the alpha under the CropThreshold
+	TrimAlpha TrimMode = iota
+	// TrimColorKey trims the pixels matching the TrimColor
+	TrimColorKey
+)
+
+// DedupMode defines the enum for the duplicate detection
+type DedupMode int
+
+const (
+	// DedupExact merges only the images with the same pixels
+	DedupExact DedupMode = iota
+	// DedupTolerance merges the images whose trimmed content differs at most
+	// by the DedupTolerance in every channel
+	DedupTolerance
+	// DedupPerceptual merges the images whose trimmed content has the
+	// perceptual hash within the DedupDistance
+	DedupPerceptual
+)
+
+// Transform defines the enum for the DedupTransforms flips and rotations
+type Transform int
+
+const (
+	// TransformNone keeps the image as it is
+	TransformNone Transform = iota
+	// TransformFlipH flips the image horizontally
+	TransformFlipH
+	// TransformFlipV flips the image vertically
+	TransformFlipV
+	// TransformRotate90 rotates the image by 90 degrees counterclockwise
+	TransformRotate90
+	// TransformRotate180 rotates the image by 180 degrees
+	TransformRotate180
+	// TransformRotate270 rotates the image by 270 degrees counterclockwise
+	TransformRotate270
+	// TransformTranspose flips the image over its main diagonal
+	TransformTranspose
+	// TransformTransverse flips the image over its other diagonal
+	TransformTransverse
 )
+
+var transformNames = []string{"none", "flipH", "flipV", "rotate90", "rotate180", "rotate270", "transpose", "transverse"}
+
+func (t Transform) String() string {
+	if t < 0 || int(t) >= len(transformNames) {
+		return "unknown"
+	}
+	return transformNames[t]
+}
+
+// MarshalText encodes the transform by its name
+func (t Transform) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// SizePolicy defines the enum for the bin sizes
+type SizePolicy int
+
+const (
+	// SizeAny allows any bin size
+	SizeAny SizePolicy = iota
+	// SizePOT rounds the bin sizes up to the power of two
+	SizePOT
+	// SizeMultiple rounds the bin sizes up to the multiple of SizeMultiple
+	SizeMultiple
+)
+
+// OverflowPolicy defines the enum for the MaxPages overflow
+type OverflowPolicy int
+
+const (
+	// OverflowFail fails the Pack with the images reported as unplaced
+	OverflowFail OverflowPolicy = iota
+	// OverflowDrop leaves out the lowest priority images
+	OverflowDrop
+	// OverflowDownscale downscales the largest images until they fit
+	OverflowDownscale
+)
+
+// PackingMode defines the enum for the placement
+type PackingMode int
+
+const (
+	// PackRects places the rectangles of the images by the MaxRects
+	PackRects PackingMode = iota
+	// PackMasks places the images by their pixels so they interlock, it is
+	// experimental and much slower than the PackRects
+	PackMasks
+)
+
+// QuantizeMode defines the enum for the page quantization
+type QuantizeMode int
+
+const (
+	// QuantizeNone keeps the pages in the RGBA
+	QuantizeNone QuantizeMode = iota
+	// QuantizeMedianCut reduces the colors by the median cut
+	QuantizeMedianCut
+	// QuantizeOctree reduces the colors by the octree
+	QuantizeOctree
+)
+
+// MeshMode defines the enum for the sprite meshes
+type MeshMode int
+
+const (
+	// MeshNone emits no meshes
+	MeshNone MeshMode = iota
+	// MeshConvex emits the convex meshes
+	MeshConvex
+	// MeshConcave emits the meshes following the concave edges
+	MeshConcave
+)
+
+// LoopMode defines the enum for the animation playback
+type LoopMode int
+
+const (
+	// LoopForever repeats the animation
+	LoopForever LoopMode = iota
+	// LoopOnce plays the animation once
+	LoopOnce
+	// LoopPingPong repeats the animation forwards and backwards
+	LoopPingPong
+)
+
+var loopModes = []string{"loop", "once", "pingpong"}
+
+func (m LoopMode) String() string {
+	if m < 0 || int(m) >= len(loopModes) {
+		return "unknown"
+	}
+	return loopModes[m]
+}
+
+// MarshalText encodes the mode by its name
+func (m LoopMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText decodes the mode from its name
+func (m *LoopMode) UnmarshalText(text []byte) error {
+	for i, name := range loopModes {
+		if name == string(text) {
+			*m = LoopMode(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown loop mode %q", text)
+}
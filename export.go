@@ -0,0 +1,199 @@
+package packer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strconv"
+)
+
+// ErrInvalidPage is an error thrown when the page is not packed
+var ErrInvalidPage = errors.New("Invalid page provided")
+
+// ErrRotationDirection is an error thrown when the format reads the other
+// rotation direction
+var ErrRotationDirection = errors.New("Rotation direction not supported by the format")
+
+type jsonRect struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+type jsonSize struct {
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+type jsonFrame struct {
+	Frame            jsonRect  `json:"frame"`
+	Rotated          bool      `json:"rotated"`
+	Trimmed          bool      `json:"trimmed"`
+	SpriteSourceSize jsonRect  `json:"spriteSourceSize"`
+	SourceSize       jsonSize  `json:"sourceSize"`
+	Pivot            Pivot     `json:"pivot"`
+	Transform        Transform `json:"transform,omitempty"`
+	Scale9Enabled    bool      `json:"scale9Enabled,omitempty"`
+	Scale9Borders    *jsonRect `json:"scale9Borders,omitempty"`
+	Scale9Paddings   *jsonRect `json:"scale9Paddings,omitempty"`
+
+	Vertices   [][2]float64 `json:"vertices,omitempty"`
+	VerticesUV [][2]float64 `json:"verticesUV,omitempty"`
+	Triangles  [][3]int     `json:"triangles,omitempty"`
+}
+
+type jsonTiming struct {
+	Durations []float64 `json:"durations"`
+	Loop      LoopMode  `json:"loop"`
+}
+
+type jsonMeta struct {
+	App        string                 `json:"app"`
+	Image      string                 `json:"image"`
+	Format     string                 `json:"format"`
+	Size       jsonSize               `json:"size"`
+	Scale      string                 `json:"scale"`
+	Rotation   RotationDirection      `json:"rotation"`
+	Animations map[string]*jsonTiming `json:"animations,omitempty"`
+}
+
+type jsonAtlas struct {
+	Frames     map[string]*jsonFrame `json:"frames"`
+	Animations map[string][]string   `json:"animations,omitempty"`
+	Meta       jsonMeta              `json:"meta"`
+}
+
+// WriteJSON writes the page in the TexturePacker JSON hash format read by
+// Phaser and Pixi, with the animations, meshes and transforms. The format
+// reads the clockwise rotation, so the RotateCCW pages fail with the
+// ErrRotationDirection.
+func (p *Packer) WriteJSON(w io.Writer, textureID int, image string) error {
+	if p.result == nil || textureID < 0 || textureID >= len(p.OutputImages) {
+		return ErrInvalidPage
+	}
+	return p.writeJSON(w, p.OutputImages[textureID], p.result.Frames, 1, image)
+}
+
+// WriteVariantJSON writes the variant page as the WriteJSON
+func (p *Packer) WriteVariantJSON(w io.Writer, v *Variant, textureID int, image string) error {
+	if p.result == nil || textureID < 0 || textureID >= len(v.OutputImages) {
+		return ErrInvalidPage
+	}
+	return p.writeJSON(w, v.OutputImages[textureID], v.Frames, v.Scale, image)
+}
+
+// writeJSON writes the page packed at the scale
+func (p *Packer) writeJSON(w io.Writer, page *OutputImage, frames []*Frame, scale float64, image string) error {
+	for _, f := range frames {
+		if f.TextureID == page.ID && f.Rotated && f.Direction != RotateCW {
+			return ErrRotationDirection
+		}
+	}
+
+	size := page.Image.Bounds().Size()
+	atlas := &jsonAtlas{
+		Frames: map[string]*jsonFrame{},
+		Meta: jsonMeta{
+			App:      "github.com/huttarichard/packer",
+			Image:    image,
+			Format:   "RGBA8888",
+			Size:     jsonSize{W: size.X, H: size.Y},
+			Scale:    strconv.FormatFloat(scale, 'g', -1, 64),
+			Rotation: p.cfg.RotationDirection,
+		},
+	}
+
+	byImage := map[*InputImage]*Frame{}
+	for _, f := range frames {
+		byImage[f.Image] = f
+		if f.TextureID != page.ID {
+			continue
+		}
+		atlas.Frames[frameName(f.Image)] = exportFrame(f)
+	}
+
+	for _, a := range p.result.Animations {
+		var names []string
+		var durations []float64
+		for i, f := range a.Frames {
+			f, ok := byImage[f.Image]
+			if !ok || f.TextureID != page.ID {
+				continue
+			}
+			names = append(names, frameName(f.Image))
+			durations = append(durations, a.Durations[i].Seconds()*1000)
+		}
+		if len(names) == 0 {
+			continue
+		}
+
+		if atlas.Animations == nil {
+			atlas.Animations = map[string][]string{}
+			atlas.Meta.Animations = map[string]*jsonTiming{}
+		}
+		atlas.Animations[a.Name] = names
+		atlas.Meta.Animations[a.Name] = &jsonTiming{Durations: durations, Loop: a.Loop}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(atlas)
+}
+
+// exportFrame converts the frame, the rotated size is the unrotated one and
+// the merged frames get their transform
+func exportFrame(f *Frame) *jsonFrame {
+	size := f.Rect.Size()
+	if f.Rotated {
+		size = image.Pt(size.Y, size.X)
+	}
+
+	content := size
+	if f.Transform.swapsAxes() {
+		content = image.Pt(size.Y, size.X)
+	}
+
+	frame := &jsonFrame{
+		Frame:            jsonRect{X: f.Rect.Min.X, Y: f.Rect.Min.Y, W: size.X, H: size.Y},
+		Rotated:          f.Rotated,
+		Trimmed:          f.Trim != Trim{},
+		SpriteSourceSize: jsonRect{X: f.Trim.Left, Y: f.Trim.Top, W: content.X, H: content.Y},
+		SourceSize:       jsonSize{W: f.SourceSize.X, H: f.SourceSize.Y},
+		Pivot:            f.Pivot,
+		Transform:        f.Transform,
+	}
+
+	if n := f.NineSlice; n != nil {
+		frame.Scale9Enabled = true
+		frame.Scale9Borders = insetsRect(n.Split, f.SourceSize)
+		if n.Pad != nil {
+			frame.Scale9Paddings = insetsRect(*n.Pad, f.SourceSize)
+		}
+	}
+
+	if m := f.Mesh; m != nil {
+		for i, v := range m.Vertices {
+			frame.Vertices = append(frame.Vertices, [2]float64{v.X, v.Y})
+			frame.VerticesUV = append(frame.VerticesUV, [2]float64{m.AtlasVertices[i].X, m.AtlasVertices[i].Y})
+		}
+		frame.Triangles = m.Triangles
+	}
+
+	return frame
+}
+
+// insetsRect converts the insets to the rectangle
+func insetsRect(i Insets, size image.Point) *jsonRect {
+	return &jsonRect{X: i.Left, Y: i.Top, W: size.X - i.Left - i.Right, H: size.Y - i.Top - i.Bottom}
+}
+
+// frameName gets the image name, the unnamed images use their IDs
+func frameName(img *InputImage) string {
+	if img.Name != "" {
+		return img.Name
+	}
+	return fmt.Sprintf("image_%d", img.id)
+}
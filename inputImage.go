@@ -3,11 +3,10 @@ package packer
 import (
 	"bytes"
 	"errors"
-	"hash/crc64"
 	"image"
 	"image/draw"
-	"image/jpeg"
 	"io"
+	"time"
 )
 
 // InputImage is the image wrapper that defines the position of the
@@ -17,14 +16,45 @@ type InputImage struct {
 	hash      uint64
 	textureID int
 
-	id                int
-	duplicatedID      *int
-	Name              string
+	id            int
+	duplicatedID  *int
+	mergeError    int
+	mergeDistance int
+	unplacedErr   error
+	// transform draws the merged image from the region of its duplicate
+	transform Transform
+
+	// rank is the priority of the image or of its highest priority duplicate
+	rank int
+
+	// dropped and downscaled by the overflow policies
+	dropped    bool
+	downscale  float64
+	downscaled *scaledImage
+
+	Name string
+	// Priority orders the images before the SortOrder, the higher priority
+	// images are placed first and dropped or downscaled last on overflow
+	Priority int
+	// Duration is the display time of the animation frame
+	Duration time.Duration
+
+	pivot     *Pivot
+	nineSlice *NineSlice
+
 	pos               image.Point
 	size, sizeCurrent image.Rectangle
 	crop              image.Rectangle
+	offset            image.Point
 
 	cropped, rotated bool
+	// tile is cut by the AddTileMap, the tiles are not animation frames
+	tile bool
+}
+
+// Placed reports whether the last Pack placed the image
+func (i *InputImage) Placed() bool {
+	return !i.pos.Eq(unplaced)
 }
 
 // PackedPosition gets the position of the image within the packed image
@@ -37,7 +67,69 @@ func (i *InputImage) Bounds() image.Rectangle {
 	return i.size
 }
 
-// Hash gets the image hash value
+// Offset gets the image position in its sprite sheet
+func (i *InputImage) Offset() image.Point {
+	return i.offset
+}
+
+// Pivot gets the normalized pivot, the center by default
+func (i *InputImage) Pivot() Pivot {
+	if i.pivot == nil {
+		return Pivot{X: 0.5, Y: 0.5}
+	}
+	return *i.pivot
+}
+
+// SetPivot sets the pivot normalized to the untrimmed size, 0,0 is the top
+// left corner
+func (i *InputImage) SetPivot(x, y float64) {
+	i.pivot = &Pivot{X: x, Y: y}
+}
+
+// SetPivotPixels sets the pivot in the untrimmed image pixels
+func (i *InputImage) SetPivotPixels(x, y float64) {
+	size := i.size.Size()
+	i.SetPivot(x/float64(size.X), y/float64(size.Y))
+}
+
+// Trim gets the pixels trimmed by the last Pack
+func (i *InputImage) Trim() Trim {
+	if !i.cropped {
+		return Trim{}
+	}
+	return Trim{
+		Left:   i.crop.Min.X - i.size.Min.X,
+		Top:    i.crop.Min.Y - i.size.Min.Y,
+		Right:  i.size.Max.X - i.crop.Max.X,
+		Bottom: i.size.Max.Y - i.crop.Max.Y,
+	}
+}
+
+// source gets the packed region
+func (i *InputImage) source() image.Rectangle {
+	if i.cropped {
+		return i.crop
+	}
+	return i.size
+}
+
+// content gets the packed image and region
+func (i *InputImage) content() (image.Image, image.Rectangle) {
+	if i.downscaled != nil {
+		return i.downscaled.content, i.downscaled.content.Bounds()
+	}
+	return i.image, i.source()
+}
+
+// scale gets the packed content scale
+func (i *InputImage) scale() float64 {
+	if i.downscale == 0 {
+		return 1
+	}
+	return i.downscale
+}
+
+// Hash gets the image hash value, the pixel checksum by default
 func (i *InputImage) Hash() uint64 {
 	return i.hash
 }
@@ -58,17 +150,49 @@ type images struct {
 }
 
 func (im *images) Less(i, j int) bool {
+	a, b := im.inputImages[i], im.inputImages[j]
+	if a.rank != b.rank {
+		return a.rank > b.rank
+	}
+
+	if compare := im.compare(); compare != nil {
+		if compare(a.image.Bounds(), b.image.Bounds()) {
+			return true
+		}
+		if compare(b.image.Bounds(), a.image.Bounds()) {
+			return false
+		}
+	}
+
+	// the images equal by the order are ordered canonically so the
+	// order does not depend on the order the images were added in
+	return canonicalLess(a, b)
+}
+
+// canonicalLess orders the images by the name, hash and pixels, only the
+// same images keep their add order
+func canonicalLess(a, b *InputImage) bool {
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	if a.hash != b.hash {
+		return a.hash < b.hash
+	}
+	return comparePixels(a.image, b.image) < 0
+}
+
+func (im *images) compare() func(i, j image.Rectangle) bool {
 	switch im.sortOrder {
 	case OrderByWidth:
-		return compareImageByWidth(im.inputImages[i].image.Bounds(), im.inputImages[j].image.Bounds())
+		return compareImageByWidth
 	case OrderByHeight:
-		return compareImageByHeight(im.inputImages[i].image.Bounds(), im.inputImages[j].image.Bounds())
+		return compareImageByHeight
 	case OrderByArea:
-		return compareImageByArea(im.inputImages[i].image.Bounds(), im.inputImages[j].image.Bounds())
+		return compareImageByArea
 	case OrderByMax:
-		return compareImageByMax(im.inputImages[i].image.Bounds(), im.inputImages[j].image.Bounds())
+		return compareImageByMax
 	}
-	return false
+	return nil
 }
 
 func (im *images) Len() int {
@@ -97,19 +221,11 @@ func (p *Packer) AddImageReader(r io.Reader) (*InputImage, error) {
 	return p.addImage(r)
 }
 
-// AddImage adds the image with the hash provided
+// AddImage adds the image with the hash provided, by default the pixel
+// checksum. The duplicates are confirmed by their pixels.
 func (p *Packer) AddImage(img image.Image, hash ...uint64) (*InputImage, error) {
-
 	var h uint64
-	if len(hash) == 0 || (len(hash) > 0 && hash[0] == 0) {
-
-		buf := &bytes.Buffer{}
-		if err := jpeg.Encode(buf, img, nil); err != nil {
-			return nil, err
-		}
-		h = crc64.Checksum(buf.Bytes(), p.table)
-		buf.Reset()
-	} else {
+	if len(hash) > 0 {
 		h = hash[0]
 	}
 	return p.getInputImageData(img, h)
@@ -122,20 +238,27 @@ func (p *Packer) addImageBytes(data []byte) (*InputImage, error) {
 }
 
 func (p *Packer) addImage(r io.Reader) (*InputImage, error) {
-	buf := &bytes.Buffer{}
-	tee := io.TeeReader(r, buf)
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
 
-	img, _, err := image.Decode(tee)
+	return p.getInputImageData(img, 0)
+}
+
+func (p *Packer) getInputImageData(img image.Image, hash uint64) (*InputImage, error) {
+	t, err := p.newInputImage(img, hash)
 	if err != nil {
 		return nil, err
 	}
 
-	hash := crc64.Checksum(buf.Bytes(), p.table)
+	p.appendImage(t)
 
-	return p.getInputImageData(img, hash)
+	return t, nil
 }
 
-func (p *Packer) getInputImageData(img image.Image, hash uint64) (*InputImage, error) {
+// newInputImage converts, hashes and crops the image without adding it
+func (p *Packer) newInputImage(img image.Image, hash uint64) (*InputImage, error) {
 	if img.Bounds().Dx() == 0 || img.Bounds().Dy() == 0 {
 		return nil, ErrEmptyImage
 	}
@@ -146,13 +269,15 @@ func (p *Packer) getInputImageData(img image.Image, hash uint64) (*InputImage, e
 		draw.Draw(dImg, dImg.Bounds(), img, img.Bounds().Min, draw.Src)
 	}
 
+	if hash == 0 {
+		hash = p.hashPixels(dImg)
+	}
+
 	t := &InputImage{}
 	t.image = dImg
 	t.hash = hash
 	t.size = dImg.Bounds()
 	t.crop = p.crop(dImg)
 
-	p.appendImage(t)
-
 	return t, nil
 }
@@ -0,0 +1,86 @@
+package packer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+)
+
+// WriteLibGDX writes the libGDX atlas of the OutputImages files. The format
+// reads the counterclockwise rotation, so the RotateCW pages fail with the
+// ErrRotationDirection.
+func (p *Packer) WriteLibGDX(w io.Writer, pages ...string) error {
+	if p.result == nil || len(pages) != len(p.OutputImages) {
+		return ErrInvalidPage
+	}
+	for _, f := range p.result.Frames {
+		if f.Rotated && f.Direction != RotateCCW {
+			return ErrRotationDirection
+		}
+	}
+
+	type region struct {
+		name  string
+		index int
+	}
+	regions := map[*Frame]region{}
+	for _, a := range p.result.Animations {
+		for i, f := range a.Frames {
+			regions[f] = region{a.Name, i}
+		}
+	}
+
+	b := bufio.NewWriter(w)
+	for id, page := range pages {
+		size := p.OutputImages[id].Image.Bounds().Size()
+		fmt.Fprintf(b, "\n%s\n", page)
+		fmt.Fprintf(b, "size: %d, %d\n", size.X, size.Y)
+		fmt.Fprintf(b, "format: RGBA8888\nfilter: Linear, Linear\nrepeat: none\n")
+
+		for _, f := range p.result.Frames {
+			if f.TextureID != id {
+				continue
+			}
+
+			r, ok := regions[f]
+			if !ok {
+				r = region{frameName(f.Image), -1}
+			}
+			size := f.Rect.Size()
+			if f.Rotated {
+				size.X, size.Y = size.Y, size.X
+			}
+
+			fmt.Fprintf(b, "%s\n", r.name)
+			fmt.Fprintf(b, "  rotate: %t\n", f.Rotated)
+			fmt.Fprintf(b, "  xy: %d, %d\n", f.Rect.Min.X, f.Rect.Min.Y)
+			fmt.Fprintf(b, "  size: %d, %d\n", size.X, size.Y)
+			if n := f.NineSlice; n != nil {
+				writeLibGDXInsets(b, "split", n.Split, f.Trim)
+				if n.Pad != nil {
+					writeLibGDXInsets(b, "pad", *n.Pad, f.Trim)
+				}
+			}
+			fmt.Fprintf(b, "  orig: %d, %d\n", f.SourceSize.X, f.SourceSize.Y)
+			fmt.Fprintf(b, "  offset: %d, %d\n", f.Trim.Left, f.Trim.Bottom)
+			fmt.Fprintf(b, "  pivot: %d, %d\n",
+				int(math.Round(f.Pivot.X*float64(f.SourceSize.X))),
+				int(math.Round((1-f.Pivot.Y)*float64(f.SourceSize.Y))),
+			)
+			fmt.Fprintf(b, "  index: %d\n", r.index)
+		}
+	}
+
+	return b.Flush()
+}
+
+// writeLibGDXInsets writes the insets in the libGDX order
+func writeLibGDXInsets(w io.Writer, key string, i Insets, trim Trim) {
+	fmt.Fprintf(w, "  %s: %d, %d, %d, %d\n", key,
+		max(0, i.Left-trim.Left),
+		max(0, i.Right-trim.Right),
+		max(0, i.Top-trim.Top),
+		max(0, i.Bottom-trim.Bottom),
+	)
+}
@@ -0,0 +1,276 @@
+package packer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// timingSuffix is the timing sidecar suffix
+const timingSuffix = ".anim.json"
+
+// Source is the image loaded by the AddImages
+type Source struct {
+	// Name is set as the name of the added image
+	Name string
+	// Open opens the encoded image
+	Open func() (io.ReadCloser, error)
+	// NinePatch reads the image as the Android nine-patch
+	NinePatch bool
+}
+
+// FileSource creates the image file source
+func FileSource(name, path string) Source {
+	return Source{
+		Name: name,
+		Open: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		},
+	}
+}
+
+// FSSource creates the image file source in the file system
+func FSSource(fsys fs.FS, name, path string) Source {
+	return Source{
+		Name: name,
+		Open: func() (io.ReadCloser, error) {
+			return fsys.Open(path)
+		},
+	}
+}
+
+// SourceError is the source load error
+type SourceError struct {
+	Name string
+	Err  error
+}
+
+func (e *SourceError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Name, e.Err)
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// LoadError is the error of the failed sources, the other sources are added
+type LoadError struct {
+	Sources []*SourceError
+}
+
+func (e *LoadError) Error() string {
+	msg := make([]string, len(e.Sources))
+	for i, s := range e.Sources {
+		msg[i] = s.Error()
+	}
+	return fmt.Sprintf("%d images failed to load: %s", len(e.Sources), strings.Join(msg, "; "))
+}
+
+// Unwrap gets the source errors
+func (e *LoadError) Unwrap() []error {
+	errs := make([]error, len(e.Sources))
+	for i, s := range e.Sources {
+		errs[i] = s
+	}
+	return errs
+}
+
+// AddImages decodes the sources by the Workers and adds them in their order,
+// nothing is added when the context is done
+func (p *Packer) AddImages(ctx context.Context, sources ...Source) ([]*InputImage, error) {
+	workers := p.cfg.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	images := make([]*InputImage, len(sources))
+	errs := make([]error, len(sources))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(sources)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				images[i], errs[i] = p.loadSource(sources[i])
+			}
+		}()
+	}
+
+feed:
+	for i := range sources {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var loaded []*InputImage
+	var failed []*SourceError
+	for i, img := range images {
+		if errs[i] != nil {
+			failed = append(failed, &SourceError{Name: sources[i].Name, Err: errs[i]})
+			continue
+		}
+		loaded = append(loaded, img)
+	}
+	p.appendImage(loaded...)
+
+	if len(failed) != 0 {
+		return loaded, &LoadError{Sources: failed}
+	}
+	return loaded, nil
+}
+
+// AddDir adds the directory tree files, see the AddFS
+func (p *Packer) AddDir(ctx context.Context, dir string, patterns ...string) ([]*InputImage, error) {
+	return p.addFS(ctx, os.DirFS(dir), patterns)
+}
+
+// AddFS adds the files matching any of the patterns, or all the files. The
+// patterns match the path and the base name. The images are named by the
+// paths without the extensions, walk.anim.json is the walk Timing and
+// button.9.png is the button nine-patch.
+func (p *Packer) AddFS(fsys fs.FS, patterns ...string) ([]*InputImage, error) {
+	return p.addFS(p.ctx, fsys, patterns)
+}
+
+func (p *Packer) addFS(ctx context.Context, fsys fs.FS, patterns []string) ([]*InputImage, error) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	var sources []Source
+	var failed []*SourceError
+	err := fs.WalkDir(fsys, ".", func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if !matchFile(file, patterns) {
+			return nil
+		}
+		if strings.HasSuffix(file, timingSuffix) {
+			if err := p.loadTiming(fsys, file); err != nil {
+				failed = append(failed, &SourceError{Name: file, Err: err})
+			}
+			return nil
+		}
+		source := FSSource(fsys, p.fileName(file), file)
+		if strings.HasSuffix(file, ninePatchSuffix) {
+			// the .9 marker is stripped with or without the extension
+			source.NinePatch = true
+			source.Name = p.fileName(strings.TrimSuffix(file, ninePatchSuffix) + path.Ext(file))
+		}
+		sources = append(sources, source)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	images, err := p.AddImages(ctx, sources...)
+	if len(failed) == 0 {
+		return images, err
+	}
+	if err != nil {
+		loadErr, ok := err.(*LoadError)
+		if !ok {
+			return images, err
+		}
+		failed = append(failed, loadErr.Sources...)
+	}
+	return images, &LoadError{Sources: failed}
+}
+
+// loadTiming loads the timing sidecar
+func (p *Packer) loadTiming(fsys fs.FS, file string) error {
+	data, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return err
+	}
+
+	t := &Timing{}
+	if err := json.Unmarshal(data, t); err != nil {
+		return err
+	}
+	p.SetTiming(p.pathName(strings.TrimSuffix(file, timingSuffix)), t)
+	return nil
+}
+
+// fileName derives the image name from the path
+func (p *Packer) fileName(file string) string {
+	if !p.cfg.KeepExtension {
+		file = strings.TrimSuffix(file, path.Ext(file))
+	}
+	return p.pathName(file)
+}
+
+// pathName joins the path by the PathSeparator
+func (p *Packer) pathName(file string) string {
+	if p.cfg.PathSeparator != "" {
+		file = strings.ReplaceAll(file, "/", p.cfg.PathSeparator)
+	}
+	return file
+}
+
+func matchFile(file string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, file); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(file)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Packer) loadSource(s Source) (*InputImage, error) {
+	r, err := s.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var in *InputImage
+	if s.NinePatch {
+		in, err = p.newNinePatch(img)
+	} else {
+		in, err = p.newInputImage(img, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	in.Name = s.Name
+
+	return in, nil
+}
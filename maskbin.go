@@ -0,0 +1,202 @@
+package packer
+
+import (
+	"image"
+	"image/draw"
+)
+
+// bin places the images to the page
+type bin interface {
+	insertNode(input *InputImage) image.Point
+}
+
+// maskBin is the experimental bin placing the images by their pixels at
+// the first top left position keeping the MaskGap
+type maskBin struct {
+	p     *Packer
+	w, h  int
+	align int
+	// used holds the bits of the drawn pixels by the rows
+	used [][]uint64
+}
+
+func (p *Packer) newMaskBin(w, h int) *maskBin {
+	b := &maskBin{p: p, w: w, h: h, align: max(p.cfg.Alignment, 1)}
+	b.used = make([][]uint64, h)
+	for y := range b.used {
+		b.used[y] = make([]uint64, (w+63)/64)
+	}
+	return b
+}
+
+func (b *maskBin) insertNode(input *InputImage) image.Point {
+	size := input.sizeCurrent.Size()
+	if size.X == 0 || size.Y == 0 || size.X > b.w || size.Y > b.h {
+		return unplaced
+	}
+
+	src, r := input.content()
+	fp := b.p.footprint(src, r, input.rotated)
+	offset := image.Pt(b.p.border.l, b.p.border.t)
+	gap := max(b.p.cfg.MaskGap, 0)
+	test := dilate(fp, gap)
+
+	for y := 0; y+size.Y <= b.h; y += b.align {
+		for x := 0; x+size.X <= b.w; x += b.align {
+			at := image.Pt(x, y).Add(offset)
+			if b.collides(test, at.X-gap, at.Y-gap) {
+				continue
+			}
+			b.mark(fp, at)
+			return image.Pt(x, y)
+		}
+	}
+
+	return unplaced
+}
+
+// collides reports whether the rows touch the used pixels
+func (b *maskBin) collides(rows [][]uint64, x, y int) bool {
+	for i, row := range rows {
+		if y+i < 0 || y+i >= b.h {
+			continue
+		}
+		used := b.used[y+i]
+		for j, bits := range row {
+			if bits != 0 && bits&bits64(used, x+64*j) != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mark marks the footprint as used
+func (b *maskBin) mark(fp *image.Alpha, at image.Point) {
+	r := fp.Bounds()
+	for y := 0; y < r.Dy(); y++ {
+		for x := 0; x < r.Dx(); x++ {
+			if fp.Pix[y*fp.Stride+x] != 0 {
+				bx, by := at.X+x, at.Y+y
+				b.used[by][bx/64] |= 1 << uint(bx%64)
+			}
+		}
+	}
+}
+
+// bits64 gets the 64 row bits from the bit
+func bits64(row []uint64, start int) uint64 {
+	if start <= -64 || start >= 64*len(row) {
+		return 0
+	}
+	if start < 0 {
+		return row[0] << uint(-start)
+	}
+
+	i, s := start/64, uint(start%64)
+	v := row[i] >> s
+	if s != 0 && i+1 < len(row) {
+		v |= row[i+1] << (64 - s)
+	}
+	return v
+}
+
+// dilate grows the footprint rows by the gap
+func dilate(fp *image.Alpha, gap int) [][]uint64 {
+	r := fp.Bounds()
+	w, h := r.Dx()+2*gap, r.Dy()+2*gap
+	words := (w + 63) / 64
+
+	// the rows are grown horizontally first
+	wide := make([][]uint64, r.Dy())
+	for y := range wide {
+		wide[y] = make([]uint64, words)
+		for x := 0; x < r.Dx(); x++ {
+			if fp.Pix[y*fp.Stride+x] == 0 {
+				continue
+			}
+			for dx := 0; dx <= 2*gap; dx++ {
+				wide[y][(x+dx)/64] |= 1 << uint((x+dx)%64)
+			}
+		}
+	}
+
+	rows := make([][]uint64, h)
+	for y := range rows {
+		rows[y] = make([]uint64, words)
+		for sy := max(y-2*gap, 0); sy <= min(y, r.Dy()-1); sy++ {
+			for j := range rows[y] {
+				rows[y][j] |= wide[sy][j]
+			}
+		}
+	}
+
+	return rows
+}
+
+// footprint computes the drawn pixel mask of the region
+func (p *Packer) footprint(src image.Image, r image.Rectangle, rotated bool) *image.Alpha {
+	keep := p.trimFunc(src)
+	rows := newRowReader(src)
+	ox := 4 * (r.Min.X - src.Bounds().Min.X)
+	w, h := r.Dx(), r.Dy()
+
+	kept := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		row := rows.row(r.Min.Y + y)[ox : ox+4*w]
+		for x := 0; x < w; x++ {
+			kept[y*w+x] = keep(row[4*x : 4*x+4])
+		}
+	}
+
+	n := p.cfg.Extrude
+	fw, fh := w+2*n, h+2*n
+	mask := image.NewAlpha(image.Rect(0, 0, fw, fh))
+	if rotated {
+		mask = image.NewAlpha(image.Rect(0, 0, fh, fw))
+	}
+	if w == 0 || h == 0 {
+		return mask
+	}
+
+	for y := 0; y < fh; y++ {
+		for x := 0; x < fw; x++ {
+			if !kept[min(max(y-n, 0), h-1)*w+min(max(x-n, 0), w-1)] {
+				continue
+			}
+			if rotated && p.cfg.RotationDirection == RotateCW {
+				mask.Pix[x*mask.Stride+fh-1-y] = 0xff
+			} else if rotated {
+				mask.Pix[(fw-1-x)*mask.Stride+y] = 0xff
+			} else {
+				mask.Pix[y*mask.Stride+x] = 0xff
+			}
+		}
+	}
+
+	return mask
+}
+
+// drawFootprint draws the region through its footprint
+func (p *Packer) drawFootprint(dst draw.Image, src image.Image, r image.Rectangle, pos image.Point, rotated bool) {
+	mask := p.footprint(src, r, rotated)
+
+	n := p.cfg.Extrude
+	w, h := r.Dx(), r.Dy()
+	content := image.NewNRGBA(image.Rect(0, 0, w+2*n, h+2*n))
+	inner := image.Rect(n, n, n+w, n+h)
+	draw.Draw(content, inner, src, r.Min, draw.Src)
+	if n != 0 && !inner.Empty() {
+		extrude(content, inner, n)
+	}
+
+	var img image.Image = content
+	if rotated {
+		img = p.rotate(content)
+	}
+
+	// the footprints never overlap so the masked pixels are drawn over the
+	// empty page, the Src would clear the pixels outside the mask
+	at := pos.Add(image.Pt(p.border.l, p.border.t))
+	draw.DrawMask(dst, mask.Bounds().Add(at), img, image.ZP, mask, image.ZP, draw.Over)
+}
@@ -28,6 +28,9 @@ type maxRects struct {
 	Rot         Rotation
 	leftToRight bool
 	border      *border
+	// align is the alignment of the placed rectangles, their positions and
+	// sizes are rounded to its multiples
+	align int
 }
 
 func (mr *maxRects) insertNode(input *InputImage) image.Point {
@@ -36,6 +39,11 @@ func (mr *maxRects) insertNode(input *InputImage) image.Point {
 	minV := math.MaxInt32
 	mini := -1
 
+	if mr.align > 1 {
+		input.sizeCurrent = image.Rect(0, 0, roundUp(input.sizeCurrent.Dx(), mr.align), roundUp(input.sizeCurrent.Dy(), mr.align))
+		mr.alignFree()
+	}
+
 	img := input.sizeCurrent
 
 	// fmt.Printf("Image: %s\n", img)
@@ -47,33 +55,34 @@ func (mr *maxRects) insertNode(input *InputImage) image.Point {
 
 	var f *maxRectsNode
 	// fmt.Printf("Mr.F: %v\n", mr.f)
+free:
 	for i = 0; i < len(mr.f); i++ {
 
 		f = mr.f[i]
-		if (f.r.Dx() >= img.Dx() && f.r.Dy() >= img.Dy()) ||
-			(f.r.Dx() >= img.Dy() && f.r.Dy() >= img.Dx()) {
-
-			rotated = false
-			m = 0
-
-			if (f.r.Dx() >= img.Dy() && f.r.Dy() >= img.Dx()) &&
-				!(f.r.Dx() >= img.Dx() && f.r.Dy() >= img.Dy()) {
+		fits := f.r.Dx() >= img.Dx() && f.r.Dy() >= img.Dy()
+		fitsRotated := f.r.Dx() >= img.Dy() && f.r.Dy() >= img.Dx() && img.Dx() != img.Dy()
 
-				if mr.Rot == 0 {
-					continue
-				}
+		// the rotated placement is tried only when the image does not fit
+		// otherwise unless the RBestFit scores both of them
+		for _, rotated = range []bool{false, true} {
+			if !rotated && !fits {
+				continue
+			}
+			if rotated && (!fitsRotated || mr.Rot == RNever || fits && mr.Rot != RBestFit) {
+				continue
+			}
 
+			m = 0
+			if rotated {
 				img.Max = image.Pt(img.Max.Y, img.Max.X)
-				rotated = true
-				m += img.Dy()
+				if mr.Rot != RBestFit {
+					m += img.Dy()
+				}
 			}
 
 			// fmt.Println("SwitchHeu")
 			switch mr.Heur {
 			case HNone:
-				mini = i
-				i = len(mr.f)
-				continue
 			case HTl:
 
 				m += f.r.Min.Y
@@ -133,6 +142,11 @@ func (mr *maxRects) insertNode(input *InputImage) image.Point {
 			if rotated {
 				img.Max = image.Pt(img.Max.Y, img.Max.X)
 			}
+
+			// the HNone takes the first placement
+			if mr.Heur == HNone {
+				break free
+			}
 		}
 	}
 	if bestIsRotated {
@@ -166,6 +180,11 @@ func (mr *maxRects) insertNode(input *InputImage) image.Point {
 			}
 		}
 
+		// the right aligned placement is kept only when it stays aligned
+		if mr.align > 1 && buf.Min.X%mr.align != 0 {
+			buf = image.Rectangle{min, max}
+		}
+
 		// fmt.Printf("Buf: %s\n\n", buf)
 		n0.r = buf
 		mr.r = append(mr.r, buf)
@@ -210,7 +229,7 @@ func (mr *maxRects) insertNode(input *InputImage) image.Point {
 					// fmt.Println("1")
 					n := &maxRectsNode{}
 
-					min := image.Pt(n0.r.Dx()+n0.r.Min.X, f.r.Dy())
+					min := image.Pt(n0.r.Dx()+n0.r.Min.X, f.r.Min.Y)
 					max := image.Pt(min.X+f.r.Dx()+f.r.Min.X-n0.r.Dx()-n0.r.Min.X, min.Y+f.r.Dy())
 					n.r = image.Rectangle{min, max}
 
@@ -221,7 +240,7 @@ func (mr *maxRects) insertNode(input *InputImage) image.Point {
 					// fmt.Println("2")
 					n := &maxRectsNode{}
 
-					min := image.Pt(n0.r.Min.X, n0.r.Min.Y+n0.r.Dy())
+					min := image.Pt(f.r.Min.X, n0.r.Min.Y+n0.r.Dy())
 					max := image.Pt(min.X+f.r.Dx(), min.Y+f.r.Dy()+f.r.Min.Y-n0.r.Dy()-n0.r.Min.Y)
 					n.r = image.Rectangle{min, max}
 					mr.f = append(mr.f, n)
@@ -257,6 +276,10 @@ func (mr *maxRects) insertNode(input *InputImage) image.Point {
 					// fmt.Printf("Removing last: %d\n", i)
 					mr.f = append(mr.f[:j], mr.f[j+1:]...)
 					j--
+				} else if mr.f[i].r.In(mr.f[j].r) {
+					mr.f = append(mr.f[:i], mr.f[i+1:]...)
+					i--
+					break
 				}
 			}
 		}
@@ -264,7 +287,21 @@ func (mr *maxRects) insertNode(input *InputImage) image.Point {
 		return n0.r.Min
 	}
 
-	return image.Pt(999999, 999999)
+	return unplaced
+}
+
+// alignFree shrinks the free rectangles to the aligned positions
+func (mr *maxRects) alignFree() {
+	for i := 0; i < len(mr.f); i++ {
+		r := mr.f[i].r
+		r = image.Rect(roundUp(r.Min.X, mr.align), roundUp(r.Min.Y, mr.align), r.Max.X, r.Max.Y)
+		if r.Empty() {
+			mr.f = append(mr.f[:i], mr.f[i+1:]...)
+			i--
+			continue
+		}
+		mr.f[i].r = r
+	}
 }
 
 func abs(i int) int {
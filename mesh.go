@@ -0,0 +1,335 @@
+package packer
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// Vertex is the mesh vertex
+type Vertex struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Mesh is the triangulated sprite polygon
+type Mesh struct {
+	// Vertices are in the pixels of the untrimmed image
+	Vertices []Vertex
+	// AtlasVertices are in the pixels of the atlas
+	AtlasVertices []Vertex
+	// UVs are the AtlasVertices normalized to the atlas size
+	UVs []Vertex
+	// Triangles holds the three indices of the vertices for every triangle
+	Triangles [][3]int
+}
+
+// setMesh traces the frame mesh
+func (f *Frame) setMesh(p *Packer, img image.Image, r image.Rectangle, page image.Point) {
+	polygon := p.tracePolygon(img, r)
+	if len(polygon) < 3 {
+		return
+	}
+
+	m := &Mesh{Triangles: triangulate(polygon)}
+	for _, v := range polygon {
+		x, y := f.atlasPoint(v.X, v.Y)
+		m.Vertices = append(m.Vertices, Vertex{X: v.X + float64(f.Trim.Left), Y: v.Y + float64(f.Trim.Top)})
+		m.AtlasVertices = append(m.AtlasVertices, Vertex{X: x, Y: y})
+		m.UVs = append(m.UVs, Vertex{X: x / float64(page.X), Y: y / float64(page.Y)})
+	}
+	f.Mesh = m
+}
+
+// tracePolygon traces the region polygon with at most MeshVertices vertices,
+// the bounding rectangle when it does not fit
+func (p *Packer) tracePolygon(img image.Image, r image.Rectangle) []Vertex {
+	keep := p.trimFunc(img)
+	rows := newRowReader(img)
+	ox := 4 * (r.Min.X - img.Bounds().Min.X)
+
+	left := make([]int, r.Dy())
+	right := make([]int, r.Dy())
+	top, bottom := -1, -1
+	minX, maxX := r.Dx(), 0
+
+	for y := 0; y < r.Dy(); y++ {
+		row := rows.row(r.Min.Y + y)[ox : ox+4*r.Dx()]
+		left[y], right[y] = -1, -1
+		for x := 0; x < r.Dx(); x++ {
+			if keep(row[4*x : 4*x+4]) {
+				if left[y] < 0 {
+					left[y] = x
+				}
+				right[y] = x + 1
+			}
+		}
+		if left[y] < 0 {
+			continue
+		}
+		if top < 0 {
+			top = y
+		}
+		bottom = y + 1
+		minX, maxX = min(minX, left[y]), max(maxX, right[y])
+	}
+	if top < 0 {
+		return nil
+	}
+
+	// the empty rows between the kept ones span both of their neighbours
+	for y := top; y < bottom; y++ {
+		if left[y] >= 0 {
+			continue
+		}
+		next := y + 1
+		for left[next] < 0 {
+			next++
+		}
+		left[y], right[y] = min(left[y-1], left[next]), max(right[y-1], right[next])
+	}
+
+	// the rows are joined to the bands spanning all their rows, the number
+	// of the bands is limited to keep the reduction fast on the tall sprites
+	budget := max(p.cfg.MeshVertices, 4)
+	band := max(1, (bottom-top+16*budget-1)/(16*budget))
+	type span struct{ y0, y1, left, right int }
+	var spans []span
+	for y := top; y < bottom; y += band {
+		s := span{y, min(y+band, bottom), left[y], right[y]}
+		for i := s.y0; i < s.y1; i++ {
+			s.left, s.right = min(s.left, left[i]), max(s.right, right[i])
+		}
+		spans = append(spans, s)
+	}
+
+	var polygon []Vertex
+	for _, s := range spans {
+		polygon = append(polygon, Vertex{float64(s.right), float64(s.y0)}, Vertex{float64(s.right), float64(s.y1)})
+	}
+	for i := len(spans) - 1; i >= 0; i-- {
+		s := spans[i]
+		polygon = append(polygon, Vertex{float64(s.left), float64(s.y1)}, Vertex{float64(s.left), float64(s.y0)})
+	}
+	if p.cfg.Mesh == MeshConvex {
+		polygon = convexHull(polygon)
+	}
+
+	polygon = reducePolygon(polygon, budget, float64(r.Dx()), float64(r.Dy()))
+	if len(polygon) > budget {
+		x0, y0, x1, y1 := float64(minX), float64(top), float64(maxX), float64(bottom)
+		polygon = []Vertex{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}}
+	}
+
+	return polygon
+}
+
+func cross(o, a, b Vertex) float64 {
+	return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+}
+
+// convexHull computes the clockwise monotone chain hull
+func convexHull(points []Vertex) []Vertex {
+	points = append([]Vertex{}, points...)
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].X != points[j].X {
+			return points[i].X < points[j].X
+		}
+		return points[i].Y < points[j].Y
+	})
+
+	var hull []Vertex
+	for pass := 0; pass < 2; pass++ {
+		start := len(hull)
+		for _, v := range points {
+			for len(hull) >= start+2 && cross(hull[len(hull)-2], hull[len(hull)-1], v) <= 0 {
+				hull = hull[:len(hull)-1]
+			}
+			hull = append(hull, v)
+		}
+		hull = hull[:len(hull)-1]
+
+		for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+			points[i], points[j] = points[j], points[i]
+		}
+	}
+
+	return hull
+}
+
+// reducePolygon removes the vertices adding the least area until the budget
+func reducePolygon(polygon []Vertex, budget int, w, h float64) []Vertex {
+	const eps = 1e-9
+
+	type removal struct {
+		i    int
+		area float64
+		// the edge removal replaces the vertices i and i+1 with the point
+		edge  bool
+		point Vertex
+	}
+
+	at := func(i int) Vertex {
+		n := len(polygon)
+		return polygon[((i%n)+n)%n]
+	}
+
+	// valid checks the new edges of the removal do not touch the others
+	valid := func(rm removal) bool {
+		n := len(polygon)
+		var edges [][2]Vertex
+		// the edges from the vertices i+first to i+last are replaced or
+		// adjacent to the new ones
+		first, last := -2, 1
+		if rm.edge {
+			if rm.point.X < -eps || rm.point.Y < -eps || rm.point.X > w+eps || rm.point.Y > h+eps {
+				return false
+			}
+			edges = [][2]Vertex{{at(rm.i - 1), rm.point}, {rm.point, at(rm.i + 2)}}
+			last = 2
+		} else {
+			edges = [][2]Vertex{{at(rm.i - 1), at(rm.i + 1)}}
+		}
+
+		for j := 0; j < n; j++ {
+			if k := ((j-rm.i)%n + n) % n; k <= last || k >= n+first {
+				continue
+			}
+			for _, e := range edges {
+				if segmentsTouch(e[0], e[1], polygon[j], at(j+1)) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	for {
+		// the collinear vertices are removed first
+		for i := 0; i < len(polygon) && len(polygon) > 3; {
+			if math.Abs(cross(at(i-1), polygon[i], at(i+1))) < eps {
+				polygon = append(polygon[:i], polygon[i+1:]...)
+				continue
+			}
+			i++
+		}
+		if len(polygon) <= budget || len(polygon) <= 4 {
+			return polygon
+		}
+
+		var removals []removal
+		for i := range polygon {
+			a, v, b := at(i-1), polygon[i], at(i+1)
+			if c := cross(a, v, b); c < 0 {
+				removals = append(removals, removal{i: i, area: -c / 2})
+				continue
+			}
+
+			// the edge from the vertex to the next one when both are convex
+			c := at(i + 2)
+			if cross(v, b, c) <= 0 {
+				continue
+			}
+			d1 := Vertex{v.X - a.X, v.Y - a.Y}
+			d2 := Vertex{b.X - c.X, b.Y - c.Y}
+			den := d1.X*d2.Y - d1.Y*d2.X
+			if math.Abs(den) < eps {
+				continue
+			}
+			t := ((b.X-v.X)*d2.Y - (b.Y-v.Y)*d2.X) / den
+			s := ((b.X-v.X)*d1.Y - (b.Y-v.Y)*d1.X) / den
+			if t <= 0 || s <= 0 {
+				continue
+			}
+			q := Vertex{v.X + t*d1.X, v.Y + t*d1.Y}
+			removals = append(removals, removal{i: i, area: math.Abs(cross(v, q, b)) / 2, edge: true, point: q})
+		}
+		sort.SliceStable(removals, func(i, j int) bool {
+			return removals[i].area < removals[j].area
+		})
+
+		removed := false
+		for _, rm := range removals {
+			if !valid(rm) {
+				continue
+			}
+			if rm.edge {
+				next := (rm.i + 1) % len(polygon)
+				polygon[rm.i] = rm.point
+				polygon = append(polygon[:next], polygon[next+1:]...)
+			} else {
+				polygon = append(polygon[:rm.i], polygon[rm.i+1:]...)
+			}
+			removed = true
+			break
+		}
+		if !removed {
+			return polygon
+		}
+	}
+}
+
+// segmentsTouch reports whether the segments touch
+func segmentsTouch(a, b, c, d Vertex) bool {
+	d1, d2 := cross(c, d, a), cross(c, d, b)
+	d3, d4 := cross(a, b, c), cross(a, b, d)
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		return true
+	}
+
+	on := func(p, q, r Vertex) bool {
+		return math.Min(p.X, q.X) <= r.X && r.X <= math.Max(p.X, q.X) &&
+			math.Min(p.Y, q.Y) <= r.Y && r.Y <= math.Max(p.Y, q.Y)
+	}
+	return d1 == 0 && on(c, d, a) || d2 == 0 && on(c, d, b) ||
+		d3 == 0 && on(a, b, c) || d4 == 0 && on(a, b, d)
+}
+
+// triangulate splits the polygon by the ear clipping
+func triangulate(polygon []Vertex) [][3]int {
+	index := make([]int, len(polygon))
+	for i := range index {
+		index[i] = i
+	}
+
+	var triangles [][3]int
+	for len(index) > 3 {
+		n := len(index)
+		clipped := false
+		for k := 0; k < n; k++ {
+			ia, iv, ib := index[(k+n-1)%n], index[k], index[(k+1)%n]
+			a, v, b := polygon[ia], polygon[iv], polygon[ib]
+			if cross(a, v, b) <= 0 {
+				continue
+			}
+
+			ear := true
+			for _, j := range index {
+				if j == ia || j == iv || j == ib {
+					continue
+				}
+				pt := polygon[j]
+				if cross(a, v, pt) >= 0 && cross(v, b, pt) >= 0 && cross(b, a, pt) >= 0 {
+					ear = false
+					break
+				}
+			}
+			if !ear {
+				continue
+			}
+
+			triangles = append(triangles, [3]int{ia, iv, ib})
+			index = append(index[:k], index[k+1:]...)
+			clipped = true
+			break
+		}
+		if !clipped {
+			break
+		}
+	}
+	if len(index) == 3 {
+		triangles = append(triangles, [3]int{index[0], index[1], index[2]})
+	}
+
+	return triangles
+}
@@ -0,0 +1,153 @@
+package packer
+
+import (
+	"errors"
+	"github.com/disintegration/imaging"
+	"image"
+	"image/color"
+	"math"
+)
+
+// ErrInvalidNinePatch is an error thrown when the nine-patch has no guides
+var ErrInvalidNinePatch = errors.New("Invalid nine-patch guides provided")
+
+// ninePatchSuffix is the nine-patch suffix
+const ninePatchSuffix = ".9.png"
+
+// Insets holds the edge distances
+type Insets struct {
+	Left, Top, Right, Bottom int
+}
+
+// NineSlice is the scale-9 layout in the untrimmed coordinates
+type NineSlice struct {
+	Split Insets
+	Pad   *Insets
+}
+
+// scaled scales the insets
+func (n *NineSlice) scaled(scale float64) *NineSlice {
+	s := &NineSlice{Split: n.Split.scaled(scale)}
+	if n.Pad != nil {
+		pad := n.Pad.scaled(scale)
+		s.Pad = &pad
+	}
+	return s
+}
+
+func (i Insets) scaled(scale float64) Insets {
+	if scale == 1 {
+		return i
+	}
+	round := func(v int) int {
+		return int(math.Round(float64(v) * scale))
+	}
+	return Insets{Left: round(i.Left), Top: round(i.Top), Right: round(i.Right), Bottom: round(i.Bottom)}
+}
+
+// NineSlice gets the scale-9 layout
+func (i *InputImage) NineSlice() *NineSlice {
+	return i.nineSlice
+}
+
+// SetNineSlice sets the scale-9 layout, only the borders are trimmed
+func (i *InputImage) SetNineSlice(n NineSlice) {
+	i.nineSlice = &n
+
+	center := image.Rect(
+		i.size.Min.X+n.Split.Left,
+		i.size.Min.Y+n.Split.Top,
+		i.size.Max.X-n.Split.Right,
+		i.size.Max.Y-n.Split.Bottom,
+	).Intersect(i.size)
+	if center.Empty() {
+		return
+	}
+	if i.crop.Empty() {
+		i.crop = center
+		return
+	}
+	i.crop = i.crop.Union(center)
+}
+
+// AddNinePatch adds the Android nine-patch image
+func (p *Packer) AddNinePatch(img image.Image) (*InputImage, error) {
+	in, err := p.newNinePatch(img)
+	if err != nil {
+		return nil, err
+	}
+
+	p.appendImage(in)
+	return in, nil
+}
+
+func (p *Packer) newNinePatch(img image.Image) (*InputImage, error) {
+	content, n, err := decodeNinePatch(img)
+	if err != nil {
+		return nil, err
+	}
+
+	in, err := p.newInputImage(content, 0)
+	if err != nil {
+		return nil, err
+	}
+	in.SetNineSlice(n)
+
+	return in, nil
+}
+
+// decodeNinePatch strips and reads the nine-patch guides
+func decodeNinePatch(img image.Image) (image.Image, NineSlice, error) {
+	b := img.Bounds()
+	w, h := b.Dx()-2, b.Dy()-2
+	if w <= 0 || h <= 0 {
+		return nil, NineSlice{}, ErrInvalidNinePatch
+	}
+
+	guide := func(x, y int) bool {
+		return color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)) == color.NRGBA{A: 0xff}
+	}
+
+	// span finds the insets of the guide marked by the pixels from 1 to n
+	span := func(n int, at func(i int) bool) (first, last int, ok bool) {
+		first = -1
+		for i := 0; i < n; i++ {
+			if at(i + 1) {
+				if first < 0 {
+					first = i
+				}
+				last = i
+			}
+		}
+		return first, n - last - 1, first >= 0
+	}
+
+	var n NineSlice
+	left, right, okX := span(w, func(i int) bool { return guide(i, 0) })
+	top, bottom, okY := span(h, func(i int) bool { return guide(0, i) })
+	if !okX && !okY {
+		return nil, NineSlice{}, ErrInvalidNinePatch
+	}
+	if okX {
+		n.Split.Left, n.Split.Right = left, right
+	}
+	if okY {
+		n.Split.Top, n.Split.Bottom = top, bottom
+	}
+
+	// the missing content guide spans the stretched region
+	left, right, okX = span(w, func(i int) bool { return guide(i, h+1) })
+	top, bottom, okY = span(h, func(i int) bool { return guide(w+1, i) })
+	if okX || okY {
+		pad := n.Split
+		if okX {
+			pad.Left, pad.Right = left, right
+		}
+		if okY {
+			pad.Top, pad.Bottom = top, bottom
+		}
+		n.Pad = &pad
+	}
+
+	return imaging.Crop(img, image.Rect(1, 1, w+1, h+1).Add(b.Min)), n, nil
+}
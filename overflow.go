@@ -0,0 +1,148 @@
+package packer
+
+import (
+	"errors"
+	"sort"
+)
+
+// downscaleStep is the OverflowDownscale step
+const downscaleStep = 0.9
+
+// overflowed reports whether the images exceed the MaxPages
+func (p *Packer) overflowed() bool {
+	for _, img := range p.images.inputImages {
+		if img.unplacedErr == ErrPageLimit {
+			return true
+		}
+	}
+	return false
+}
+
+// priorityOrder returns the placeable images by their priority
+func (p *Packer) priorityOrder() []*InputImage {
+	var tooLarge *ImageTooLargeError
+	var order []*InputImage
+
+	for _, img := range p.images.inputImages {
+		if (img.duplicatedID != nil && p.cfg.Merge) || errors.As(img.unplacedErr, &tooLarge) {
+			continue
+		}
+		order = append(order, img)
+	}
+	return order
+}
+
+// dropOverflow drops the lowest priority images
+func (p *Packer) dropOverflow(heur Heuristic, w, h int) error {
+	order := p.priorityOrder()
+
+	fits := func(keep int) (bool, error) {
+		dropped := map[int]bool{}
+		for i, img := range order {
+			img.dropped = i >= keep
+			dropped[img.id] = img.dropped
+		}
+		for _, img := range p.images.inputImages {
+			if img.duplicatedID != nil && p.cfg.Merge {
+				img.dropped = dropped[*img.duplicatedID]
+			}
+		}
+
+		p.sortImages(w, h)
+		if err := p.place(heur, w, h); err != nil {
+			return false, err
+		}
+		return !p.overflowed(), nil
+	}
+
+	lo, hi := 0, len(order)-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		ok, err := fits(mid)
+		if err != nil {
+			return err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	if _, err := fits(lo); err != nil {
+		return err
+	}
+
+	for _, img := range p.images.inputImages {
+		if img.dropped {
+			p.result.Dropped = append(p.result.Dropped, img)
+		}
+	}
+	return nil
+}
+
+// downscaleOverflow downscales the largest images
+func (p *Packer) downscaleOverflow(heur Heuristic, w, h int) error {
+	limit := p.cfg.MinDownscale
+	if limit <= 0 {
+		limit = 0.01
+	}
+
+	for p.overflowed() {
+		var candidates []*InputImage
+		for _, img := range p.priorityOrder() {
+			if img.scale()*downscaleStep >= limit {
+				candidates = append(candidates, img)
+			}
+		}
+		if len(candidates) == 0 {
+			return nil
+		}
+
+		// the higher priority images are downscaled only when the lower
+		// priority ones reach the limit
+		rank := candidates[len(candidates)-1].rank
+		for len(candidates) != 0 && candidates[0].rank != rank {
+			candidates = candidates[1:]
+		}
+
+		area := func(img *InputImage) int {
+			_, r := img.content()
+			return r.Dx() * r.Dy()
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return area(candidates[i]) > area(candidates[j])
+		})
+
+		// the images at least half as large as the largest one are downscaled
+		largest := area(candidates[0])
+		for _, img := range candidates {
+			if 2*area(img) < largest {
+				break
+			}
+			p.downscaleImage(img, img.scale()*downscaleStep)
+		}
+
+		p.sortImages(w, h)
+		if err := p.place(heur, w, h); err != nil {
+			return err
+		}
+	}
+
+	for _, img := range p.images.inputImages {
+		if img.downscale != 0 {
+			p.result.Downscaled = append(p.result.Downscaled, &DownscaledImage{Image: img, Scale: img.downscale})
+		}
+	}
+	return nil
+}
+
+// downscaleImage downscales the image with its duplicates
+func (p *Packer) downscaleImage(img *InputImage, scale float64) {
+	for _, t := range p.images.inputImages {
+		if t == img || (p.cfg.Merge && t.duplicatedID != nil && *t.duplicatedID == img.id) {
+			t.downscale = scale
+			t.downscaled = p.scaleImage(t, scale)
+		}
+	}
+}
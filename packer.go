@@ -2,6 +2,8 @@ package packer
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/disintegration/imaging"
 	"hash/crc64"
 	"image"
@@ -16,6 +18,45 @@ const (
 	mininputImageSizeY = 32
 )
 
+var (
+	// ErrImageTooLarge is an error thrown when the image does not fit the page,
+	// the thrown error is the *ImageTooLargeError
+	ErrImageTooLarge = errors.New("Image does not fit the page")
+
+	// ErrMaxSizeExceeded is the reason of the images left out when the
+	// growing page reaches the maximum size
+	ErrMaxSizeExceeded = errors.New("Images do not fit the maximum page size")
+
+	// ErrPageLimit is the reason of the images left out when the pages
+	// exceed the MaxPages
+	ErrPageLimit = errors.New("Images exceed the maximum page count")
+
+	// ErrNotPlaced is the reason of the images left out for no other reason
+	ErrNotPlaced = errors.New("Image could not be placed")
+)
+
+// unplaced is the unplaced image position
+var unplaced = image.Pt(999999, 999999)
+
+// ImageTooLargeError is the error of the image larger than the page
+type ImageTooLargeError struct {
+	Image *InputImage
+	Name  string
+	// Size is the size of the image including the border and the extrusion
+	Size image.Point
+	// Max is the maximum page size, zero is unlimited
+	Max image.Point
+}
+
+func (e *ImageTooLargeError) Error() string {
+	return fmt.Sprintf("Image %q of size %dx%d does not fit the page of size %dx%d", e.Name, e.Size.X, e.Size.Y, e.Max.X, e.Max.Y)
+}
+
+// Unwrap returns the ErrImageTooLarge
+func (e *ImageTooLargeError) Unwrap() error {
+	return ErrImageTooLarge
+}
+
 // OutputImage is the packed image, result from the Packer Pack
 type OutputImage struct {
 	draw.Image
@@ -34,14 +75,19 @@ type Packer struct {
 	mergedImages     int
 	Ltr, mergeBF     bool
 	MinFillRate      int
-	cropThreshold    int
-	Rotate           Rotation
 	border           border
 
 	bins []image.Rectangle
 
 	OutputImages []*OutputImage
 
+	result  *Result
+	timings map[string]*Timing
+
+	// tiles holds the tiles of the tileMaps by their hashes
+	tiles    map[uint64][]*InputImage
+	tileMaps []*TileMap
+
 	nextID int
 
 	table *crc64.Table
@@ -71,7 +117,7 @@ func newPacker(ctx context.Context, cfg *Config) *Packer {
 		cfg:    cfg,
 		images: &images{sortOrder: cfg.SortOrder},
 		table:  crc64.MakeTable(crc64.ECMA),
-		border: border{l: cfg.Border, r: cfg.Border},
+		border: border{t: cfg.Border, b: cfg.Border, l: cfg.Border, r: cfg.Border},
 		lock:   &sync.Mutex{},
 		hlock:  &sync.Mutex{},
 	}
@@ -82,10 +128,22 @@ func newPacker(ctx context.Context, cfg *Config) *Packer {
 // Pack packs the images with respect to the provided config parameters
 // throws an error when the context provided in the Packer Creator is Done.
 func (p *Packer) Pack() (err error) {
+	if p.cfg.Quantize != QuantizeNone && (p.cfg.PaletteSize < 2 || p.cfg.PaletteSize > 256) {
+		return ErrInvalidPalette
+	}
+
 	if err = p.pack(p.cfg.Heuristic, p.cfg.TextureWidth, p.cfg.TextureHeight); err != nil {
+		if p.ctx.Err() != nil {
+			p.result.Unplaced = p.unplacedImages(p.ctx.Err())
+		}
 		return
 	}
 
+	p.result.Unplaced = p.unplacedImages(ErrNotPlaced)
+	if (p.cfg.Strict || p.overflowed()) && len(p.result.Unplaced) != 0 {
+		return &UnplacedError{Images: p.result.Unplaced}
+	}
+
 	if err = p.createBinImages(); err != nil {
 		return
 	}
@@ -94,54 +152,99 @@ func (p *Packer) Pack() (err error) {
 		return
 	}
 
-	return
+	p.result.Frames = p.frames()
+	if p.result.Animations, err = p.animations(); err != nil {
+		return
+	}
+	p.result.TileMaps = p.resultTileMaps()
+
+	pages := append([]*OutputImage{}, p.OutputImages...)
+	for _, scale := range p.cfg.Scales {
+		var v *Variant
+		if v, err = p.packVariant(scale); err != nil {
+			return
+		}
+		p.result.Variants = append(p.result.Variants, v)
+		p.result.Unplaced = append(p.result.Unplaced, v.Unplaced...)
+		if scale != 1 {
+			pages = append(pages, v.OutputImages...)
+		}
+	}
+	if p.cfg.Strict && len(p.result.Unplaced) != 0 {
+		return &UnplacedError{Images: p.result.Unplaced}
+	}
+
+	return p.quantizeImages(pages)
 }
 
 // Reset resets the packer data
 func (p *Packer) Reset() {
 	p.bins = nil
 	p.OutputImages = nil
-	p.images = nil
-
+	p.images = &images{sortOrder: p.cfg.SortOrder}
+	p.result = nil
+	p.tiles = nil
+	p.tileMaps = nil
 }
 
 // Pack packs the images with provided heuristic
 func (p *Packer) pack(heur Heuristic, w, h int) error {
+	w, h = p.binSize(w, h)
 
+	p.recalculateDuplicates()
+	for _, texture := range p.images.inputImages {
+		texture.dropped = false
+		texture.downscale = 0
+		texture.downscaled = nil
+	}
 	p.sortImages(w, h)
 
 	p.missingImages = 1
 	p.mergedImages = 0
-	p.area = 0
+	p.result = &Result{}
 
-	p.bins = []image.Rectangle{}
-
-	if p.cfg.AutoGrow {
-		p.bins = append(p.bins, image.Rect(0, 0, w, h))
-		if err := p.growingImage(heur, w, h, false); err != nil {
-			return err
-		}
-	} else {
-		areaBuf, err := p.addImagesToBins(heur, w, h)
-		if err != nil {
-			return err
-		}
+	if err := p.place(heur, w, h); err != nil {
+		return err
+	}
 
-		// fmt.Printf("Bins: %d\n", len(p.bins))
-		if areaBuf != 0 && p.missingImages == 0 {
-			if err := p.cropLastImage(heur, w, h, false); err != nil {
+	if p.overflowed() {
+		switch p.cfg.Overflow {
+		case OverflowDrop:
+			if err := p.dropOverflow(heur, w, h); err != nil {
+				return err
+			}
+		case OverflowDownscale:
+			if err := p.downscaleOverflow(heur, w, h); err != nil {
 				return err
 			}
 		}
 	}
 
+	if p.cfg.ShrinkToFit {
+		if err := p.fitLastBin(heur); err != nil {
+			return err
+		}
+		p.shrinkBins()
+	}
+
 	if p.cfg.Merge {
 		for _, text := range p.images.inputImages {
 			if text.duplicatedID != nil {
 				dup := p.find(*text.duplicatedID)
 				text.pos = dup.pos
 				text.textureID = dup.textureID
+				text.rotated = dup.rotated
+				text.sizeCurrent = dup.sizeCurrent
 				p.mergedImages++
+
+				p.result.Merged = append(p.result.Merged, &MergedImage{
+					Image:     text,
+					Into:      dup,
+					Error:     text.mergeError,
+					Distance:  text.mergeDistance,
+					Transform: text.transform,
+				})
+				p.result.MaxError = max(p.result.MaxError, text.mergeError)
 			}
 		}
 	}
@@ -149,37 +252,56 @@ func (p *Packer) pack(heur Heuristic, w, h int) error {
 	return nil
 }
 
-// sortImages sorts the images
-func (p *Packer) sortImages(w, h int) {
-	p.recalculateDuplicates()
+// place places the images to the bins
+func (p *Packer) place(heur Heuristic, w, h int) error {
+	p.area = 0
+	p.bins = []image.Rectangle{}
 
-	p.neededArea = 0
-	var size image.Rectangle
+	if p.cfg.AutoGrow {
+		p.rejectOversized(p.maxSize())
+	} else {
+		p.rejectOversized(w, h)
+	}
 
-	for _, texture := range p.images.inputImages {
+	if p.cfg.AutoGrow {
+		p.bins = append(p.bins, image.Rect(0, 0, w, h))
+		return p.growingImage(heur, w, h, false)
+	}
 
-		texture.pos = image.Pt(999999, 999999)
-		if p.cropThreshold != 0 {
-			size = texture.crop
-		} else {
-			size = texture.size
-		}
+	areaBuf, err := p.addImagesToBins(heur, w, h)
+	if err != nil {
+		return err
+	}
 
-		if size.Dx() == w {
-			size.Max = image.Pt(size.Max.X-p.border.l-p.border.r-2*p.cfg.Extrude, size.Max.Y)
-		}
-		if size.Dy() == h {
-			size.Max = image.Pt(size.Max.X, size.Dy()-p.border.t-p.border.b-2*p.cfg.Extrude)
-		}
+	// fmt.Printf("Bins: %d\n", len(p.bins))
+	if areaBuf != 0 && p.missingImages == 0 {
+		return p.cropLastImage(heur, w, h, false)
+	}
+	return nil
+}
 
-		size.Max = image.Pt(size.Dx()+p.border.t+p.border.b+2*p.cfg.Extrude, size.Dy()+p.border.l+p.border.r+2*p.cfg.Extrude)
+// sortImages sorts the images
+func (p *Packer) sortImages(w, h int) {
+	p.neededArea = 0
+	for _, texture := range p.images.inputImages {
 
-		if p.Rotate == RWidthGreaterHeight && size.Dx() > size.Dy() ||
-			p.Rotate == RWidthGreater2Height && size.Dx() > 2*size.Dy() ||
-			p.Rotate == RHeightGreaterWidth && size.Dy() > size.Dx() ||
-			p.Rotate == RH2WidthH && size.Dy() > size.Dx() && size.Dx()*2 > size.Dy() ||
-			p.Rotate == RW2HeightW && size.Dx() > size.Dy() && size.Dy()*2 > size.Dx() ||
-			p.Rotate == RHeightGreater2Width && size.Dy() > 2*size.Dx() {
+		texture.pos = unplaced
+		texture.unplacedErr = nil
+		texture.cropped = p.cfg.Crop
+		texture.rotated = false
+
+		_, src := texture.content()
+		size := image.Rect(0, 0,
+			src.Dx()+p.border.l+p.border.r+2*p.cfg.Extrude,
+			src.Dy()+p.border.t+p.border.b+2*p.cfg.Extrude,
+		)
+
+		if p.cfg.Rotation == RWidthGreaterHeight && size.Dx() > size.Dy() ||
+			p.cfg.Rotation == RWidthGreater2Height && size.Dx() > 2*size.Dy() ||
+			p.cfg.Rotation == RHeightGreaterWidth && size.Dy() > size.Dx() ||
+			p.cfg.Rotation == RH2WidthH && size.Dy() > size.Dx() && size.Dx()*2 > size.Dy() ||
+			p.cfg.Rotation == RW2HeightW && size.Dx() > size.Dy() && size.Dy()*2 > size.Dx() ||
+			p.cfg.Rotation == RHeightGreater2Width && size.Dy() > 2*size.Dx() {
 			size.Max = image.Pt(size.Max.Y, size.Max.X)
 			texture.rotated = true
 		}
@@ -189,7 +311,7 @@ func (p *Packer) sortImages(w, h int) {
 			p.neededArea += int64(size.Dx() * size.Dy())
 		}
 	}
-	sort.Sort(p.images)
+	sort.Stable(p.images)
 }
 
 func (p *Packer) createBinImages() error {
@@ -218,59 +340,12 @@ func (p *Packer) writeImages() error {
 			continue
 		}
 
-		// fmt.Printf("Image: %d\n", img.id)
-
-		pos := image.Pt(img.pos.X+p.border.l, img.pos.Y+p.border.t)
-		var size, crop image.Rectangle
-
-		if p.cfg.CropThreshold == 0 {
-			size = img.size
-			crop = image.Rect(0, 0, size.Dx(), size.Dy())
-		} else {
-			size = img.crop
-			crop = img.crop
-		}
-
-		if img.rotated {
-			img.image = imaging.Rotate90(img.image)
-			size.Max = image.Pt(size.Max.Y, size.Max.X)
-			min := image.Pt(img.size.Dy()-crop.Min.Y-crop.Dy(), crop.Min.X)
-			max := image.Pt(min.X+crop.Dy(), min.Y+crop.Dx())
-			crop = image.Rectangle{min, max}
-		}
-
-		if img.textureID < len(p.bins) {
-			// fmt.Printf("TextureID: %d\n", img.textureID)
-			texture := p.OutputImages[img.textureID]
-			if p.cfg.Extrude != 0 {
-				color1 := img.image.At(crop.Min.X, crop.Min.Y)
-				if p.cfg.Extrude == 1 {
-					texture.Image.Set(pos.X, pos.Y, color1)
-				} else {
-					m := image.NewRGBA(image.Rect(0, 0, p.cfg.Extrude-1-pos.X, p.cfg.Extrude-1-pos.Y))
-					draw.Draw(m, m.Bounds(), &image.Uniform{color1}, image.ZP, draw.Src)
-					draw.Draw(texture, image.Rect(pos.X, pos.Y, pos.X+p.cfg.Extrude-1, pos.Y+p.cfg.Extrude-1), m, pos, draw.Src)
-				}
-
-				color2 := img.image.At(crop.Min.X, crop.Min.Y+crop.Max.Y-1)
-				if p.cfg.Extrude == 1 {
-					texture.Set(pos.X, pos.Y, color2)
-				} else {
-					m := image.NewRGBA(image.Rect(0, 0, p.cfg.Extrude-1-pos.X, p.cfg.Extrude-1-pos.Y))
-					draw.Draw(m, m.Bounds(), &image.Uniform{color2}, image.ZP, draw.Src)
-					draw.Draw(texture, image.Rect(pos.X, pos.Y, pos.X+p.cfg.Extrude-1, pos.Y+p.cfg.Extrude-1), m, pos, draw.Src)
-				}
-			} else {
-
-				// fmt.Printf("Drawing at: %s, %s\n", pos, crop)
-				size = image.Rectangle{image.Pt(pos.X, pos.Y), image.Pt(pos.X+img.crop.Dx(), pos.Y+img.crop.Dy())}
-				draw.Draw(texture.Image, size, img.image, image.ZP, draw.Src)
-			}
+		if img.textureID >= len(p.bins) {
+			continue
 		}
 
-		// clear the image data
-		// img.image = nil
-		img.size = size
+		src, r := img.content()
+		p.drawImage(p.OutputImages[img.textureID].Image, src, r, img.pos, img.rotated)
 
 		select {
 		case <-p.ctx.Done():
@@ -282,11 +357,61 @@ func (p *Packer) writeImages() error {
 	return nil
 }
 
+// drawImage draws the region to the slot
+func (p *Packer) drawImage(dst draw.Image, src image.Image, r image.Rectangle, pos image.Point, rotated bool) {
+	if p.cfg.Packing == PackMasks {
+		p.drawFootprint(dst, src, r, pos, rotated)
+		return
+	}
+
+	if rotated {
+		src = p.rotate(imaging.Crop(src, r))
+		r = src.Bounds()
+	}
+
+	offset := p.cfg.Extrude
+	pos = image.Pt(pos.X+p.border.l+offset, pos.Y+p.border.t+offset)
+	rect := r.Sub(r.Min).Add(pos)
+
+	draw.Draw(dst, rect, src, r.Min, draw.Src)
+	if p.cfg.Extrude != 0 && !rect.Empty() {
+		extrude(dst, rect, p.cfg.Extrude)
+	}
+}
+
+// rotate rotates the image in the RotationDirection
+func (p *Packer) rotate(img image.Image) *image.NRGBA {
+	if p.cfg.RotationDirection == RotateCW {
+		return imaging.Rotate270(img)
+	}
+	return imaging.Rotate90(img)
+}
+
+// extrude extrudes the region edges
+func extrude(dst draw.Image, r image.Rectangle, n int) {
+	for i := 1; i <= n; i++ {
+		draw.Draw(dst, image.Rect(r.Min.X-i, r.Min.Y, r.Min.X-i+1, r.Max.Y), dst, r.Min, draw.Src)
+		draw.Draw(dst, image.Rect(r.Max.X+i-1, r.Min.Y, r.Max.X+i, r.Max.Y), dst, image.Pt(r.Max.X-1, r.Min.Y), draw.Src)
+	}
+
+	// the rows are extruded from the already extruded columns to fill the corners
+	x0, x1 := r.Min.X-n, r.Max.X+n
+	for i := 1; i <= n; i++ {
+		draw.Draw(dst, image.Rect(x0, r.Min.Y-i, x1, r.Min.Y-i+1), dst, image.Pt(x0, r.Min.Y), draw.Src)
+		draw.Draw(dst, image.Rect(x0, r.Max.Y+i-1, x1, r.Max.Y+i), dst, image.Pt(x0, r.Max.Y-1), draw.Src)
+	}
+}
+
 func (p *Packer) addImagesToBins(heur Heuristic, w, h int) (areaBuf int, err error) {
 	binIndex := len(p.bins) - 1
 	var lastAreaBuf int
 
 	for {
+		if p.cfg.MaxPages > 0 && len(p.bins) >= p.cfg.MaxPages {
+			p.rejectMissing(ErrPageLimit)
+			break
+		}
+
 		p.missingImages = 0
 		p.bins = append(p.bins, image.Rect(0, 0, w, h))
 		binIndex++
@@ -316,10 +441,13 @@ func (p *Packer) addImagesToBins(heur Heuristic, w, h int) (areaBuf int, err err
 }
 
 func (p *Packer) cropLastImage(heur Heuristic, w, h int, wh bool) error {
+	if w <= 1 || h <= 1 {
+		return nil
+	}
+
 	p.missingImages = 0
-	lastImages := p.images.inputImages
-	lastBins := p.bins
-	lastArea := p.area
+	last := p.saveState()
+	lw, lh, lwh := w, h, wh
 
 	p.bins = p.bins[:len(p.bins)-1]
 	p.clearBin(len(p.bins))
@@ -335,6 +463,7 @@ func (p *Packer) cropLastImage(heur Heuristic, w, h int, wh bool) error {
 		}
 		wh = !wh
 	}
+	w, h = p.binSize(w, h)
 
 	binIndex := len(p.bins)
 	p.missingImages = 0
@@ -344,21 +473,9 @@ func (p *Packer) cropLastImage(heur Heuristic, w, h int, wh bool) error {
 		return err
 	}
 	if p.missingImages != 0 {
-		p.images.inputImages = lastImages
-		p.bins = lastBins
-		p.area = lastArea
+		p.restoreState(last)
 		p.missingImages = 0
-		if p.cfg.Square {
-			w *= 2
-			h *= 2
-		} else {
-			if !wh {
-				w *= 2
-			} else {
-				h *= 2
-			}
-			wh = !wh
-		}
+		w, h, wh = lw, lh, lwh
 
 		if p.cfg.Autosize {
 			rate := p.getFillRate()
@@ -367,9 +484,7 @@ func (p *Packer) cropLastImage(heur Heuristic, w, h int, wh bool) error {
 					return err
 				}
 				if p.getFillRate() <= rate {
-					p.images.inputImages = lastImages
-					p.bins = lastBins
-					p.area = lastArea
+					p.restoreState(last)
 				}
 			}
 		}
@@ -386,17 +501,27 @@ func (p *Packer) growingImage(heur Heuristic, w, h int, wh bool) error {
 	// fmt.Printf("Growing Image. W: %d, H: %d\n", w, h)
 	p.missingImages = 0
 
+	maxW, maxH := p.maxSize()
+	cappedW := maxW > 0 && w >= maxW
+	cappedH := maxH > 0 && h >= maxH
+
+	// the capped dimension stops growing, the other one keeps growing
 	if p.cfg.Square {
-		w *= 2
-		h *= 2
+		if !cappedW {
+			w *= 2
+		}
+		if !cappedH {
+			h *= 2
+		}
 	} else {
-		if !wh {
+		if !cappedW && (!wh || cappedH) {
 			w *= 2
-		} else {
+		} else if !cappedH {
 			h *= 2
 		}
 		wh = !wh
 	}
+	w, h = p.binSize(w, h)
 
 	p.bins[0] = image.Rect(0, 0, w, h)
 
@@ -406,6 +531,19 @@ func (p *Packer) growingImage(heur Heuristic, w, h int, wh bool) error {
 	}
 
 	if p.missingImages != 0 {
+		if maxW > 0 && w >= maxW && maxH > 0 && h >= maxH {
+			if !p.cfg.SpillPages {
+				p.area = int64(areaBuf)
+				p.rejectMissing(ErrMaxSizeExceeded)
+				return nil
+			}
+
+			// the page can not grow anymore, the rest goes to the extra pages
+			p.area = int64(areaBuf)
+			_, err := p.addImagesToBins(heur, w, h)
+			return err
+		}
+
 		p.clearBin(0)
 		return p.growingImage(heur, w, h, wh)
 	}
@@ -415,6 +553,64 @@ func (p *Packer) growingImage(heur Heuristic, w, h int, wh bool) error {
 
 }
 
+// maxSize returns the maximum bin size, zero is unlimited
+func (p *Packer) maxSize() (int, int) {
+	floor := func(v int) int {
+		if v <= 0 {
+			return 0
+		}
+		switch p.cfg.SizePolicy {
+		case SizePOT:
+			n := nextPOT(v)
+			if n > v {
+				n >>= 1
+			}
+			return n
+		case SizeMultiple:
+			if n := p.cfg.SizeMultiple; n > 1 && v >= n {
+				return v / n * n
+			}
+		}
+		return v
+	}
+	return floor(p.cfg.MaxTextureWidth), floor(p.cfg.MaxTextureHeight)
+}
+
+// rejectMissing records the unplaced images
+func (p *Packer) rejectMissing(err error) {
+	for _, img := range p.images.inputImages {
+		if !img.Placed() && img.unplacedErr == nil && !img.dropped && (img.duplicatedID == nil || !p.cfg.Merge) {
+			img.unplacedErr = err
+		}
+	}
+}
+
+// rejectOversized excludes the images larger than the bin
+func (p *Packer) rejectOversized(w, h int) {
+	for _, img := range p.images.inputImages {
+		if img.duplicatedID != nil && p.cfg.Merge {
+			continue
+		}
+
+		size := img.sizeCurrent.Size()
+		if a := p.cfg.Alignment; a > 1 {
+			size = image.Pt(roundUp(size.X, a), roundUp(size.Y, a))
+		}
+
+		if (w > 0 && size.X > w) || (h > 0 && size.Y > h) {
+			rotated := (w == 0 || size.Y <= w) && (h == 0 || size.X <= h)
+			if p.cfg.Rotation == RNever || !rotated {
+				img.unplacedErr = &ImageTooLargeError{
+					Image: img,
+					Name:  img.Name,
+					Size:  size,
+					Max:   image.Pt(w, h),
+				}
+			}
+		}
+	}
+}
+
 func (p *Packer) updateCrop() {
 	for _, t := range p.images.inputImages {
 		t.crop = p.crop(t.image)
@@ -423,11 +619,9 @@ func (p *Packer) updateCrop() {
 
 func (p *Packer) divideLastImage(heur Heuristic, w, h int, wh bool) error {
 	p.missingImages = 0
-	lastImages := p.images.inputImages
-	lastBins := p.bins
-	lastArea := p.area
+	last := p.saveState()
 
-	p.bins = p.bins[:len(p.bins)]
+	p.bins = p.bins[:len(p.bins)-1]
 	p.clearBin(len(p.bins))
 
 	if p.cfg.Square {
@@ -446,9 +640,7 @@ func (p *Packer) divideLastImage(heur Heuristic, w, h int, wh bool) error {
 		return err
 	}
 	if p.missingImages != 0 {
-		p.images.inputImages = lastImages
-		p.bins = lastBins
-		p.area = lastArea
+		p.restoreState(last)
 		p.missingImages = 0
 	} else {
 		if err := p.cropLastImage(heur, w, h, wh); err != nil {
@@ -459,6 +651,82 @@ func (p *Packer) divideLastImage(heur Heuristic, w, h int, wh bool) error {
 	return nil
 }
 
+// packState is the packing snapshot
+type packState struct {
+	bins      []image.Rectangle
+	area      int64
+	pos       []image.Point
+	textureID []int
+	rotated   []bool
+	size      []image.Rectangle
+	errs      []error
+}
+
+func (p *Packer) saveState() *packState {
+	s := &packState{
+		bins: append([]image.Rectangle(nil), p.bins...),
+		area: p.area,
+	}
+	for _, img := range p.images.inputImages {
+		s.pos = append(s.pos, img.pos)
+		s.textureID = append(s.textureID, img.textureID)
+		s.rotated = append(s.rotated, img.rotated)
+		s.size = append(s.size, img.sizeCurrent)
+		s.errs = append(s.errs, img.unplacedErr)
+	}
+	return s
+}
+
+func (p *Packer) restoreState(s *packState) {
+	p.bins = append(p.bins[:0], s.bins...)
+	p.area = s.area
+	for i, img := range p.images.inputImages {
+		img.pos = s.pos[i]
+		img.textureID = s.textureID[i]
+		img.rotated = s.rotated[i]
+		img.sizeCurrent = s.size[i]
+		img.unplacedErr = s.errs[i]
+	}
+}
+
+// binSize adjusts the bin size to the SizePolicy
+func (p *Packer) binSize(w, h int) (int, int) {
+	switch p.cfg.SizePolicy {
+	case SizePOT:
+		w, h = nextPOT(w), nextPOT(h)
+	case SizeMultiple:
+		if n := p.cfg.SizeMultiple; n > 1 {
+			w, h = roundUp(w, n), roundUp(h, n)
+		}
+	}
+
+	maxW, maxH := p.maxSize()
+	if maxW > 0 && w > maxW {
+		w = maxW
+	}
+	if maxH > 0 && h > maxH {
+		h = maxH
+	}
+	return w, h
+}
+
+// nextPOT returns the next power of two
+func nextPOT(v int) int {
+	n := 1
+	for n < v {
+		n <<= 1
+	}
+	return n
+}
+
+// roundUp rounds up to the multiple
+func roundUp(v, n int) int {
+	if n <= 1 {
+		return v
+	}
+	return (v + n - 1) / n * n
+}
+
 func (p *Packer) getFillRate() float64 {
 	var binArea int64
 	for _, bin := range p.bins {
@@ -471,22 +739,34 @@ func (p *Packer) getFillRate() float64 {
 func (p *Packer) fillBin(heur Heuristic, w, h, binIndex int) (int, error) {
 	var (
 		areaBuf int
-		rects   = &maxRects{}
+		rects   bin
+		mr      = &maxRects{}
 		mrn     = &maxRectsNode{}
 	)
 	mrn.r = image.Rect(0, 0, w, h)
 	// fmt.Printf("Creating bin of size: %d, %d", w, h)
-	rects.f = append(rects.f, mrn)
-	rects.Heur = heur
-	rects.leftToRight = p.Ltr
-	rects.w = w
-	rects.h = h
-	rects.Rot = p.Rotate
-	rects.border = &p.border
+	mr.f = append(mr.f, mrn)
+	mr.Heur = heur
+	mr.leftToRight = p.Ltr
+	mr.w = w
+	mr.h = h
+	mr.Rot = p.cfg.Rotation
+	mr.border = &p.border
+	mr.align = p.cfg.Alignment
+	rects = mr
+
+	if p.cfg.Packing == PackMasks {
+		rects = p.newMaskBin(w, h)
+	}
 
 	for _, text := range p.images.inputImages {
+		select {
+		case <-p.ctx.Done():
+			return 0, p.ctx.Err()
+		default:
+		}
 
-		if !text.pos.Eq(image.Pt(999999, 999999)) {
+		if text.Placed() || text.unplacedErr != nil || text.dropped {
 			continue
 		}
 		// fmt.Printf("Adding image: %x to bin: %d\n", text.hash, binIndex)
@@ -496,7 +776,7 @@ func (p *Packer) fillBin(heur Heuristic, w, h, binIndex int) (int, error) {
 			text.pos = rects.insertNode(text)
 			text.textureID = binIndex
 			// fmt.Printf("Pos: %v", text.pos)
-			if text.pos.Eq(image.Pt(999999, 999999)) {
+			if !text.Placed() {
 				p.missingImages++
 			} else {
 
@@ -505,12 +785,6 @@ func (p *Packer) fillBin(heur Heuristic, w, h, binIndex int) (int, error) {
 				p.area += int64(text.sizeCurrent.Dx() * text.sizeCurrent.Dy())
 			}
 		}
-		select {
-		case <-p.ctx.Done():
-			return 0, p.ctx.Err()
-		default:
-		}
-
 	}
 
 	return areaBuf, nil
@@ -519,9 +793,9 @@ func (p *Packer) fillBin(heur Heuristic, w, h, binIndex int) (int, error) {
 // clearBin clears the current image at index
 func (p *Packer) clearBin(binIndex int) {
 	for _, text := range p.images.inputImages {
-		if text.textureID == binIndex {
+		if text.textureID == binIndex && text.Placed() {
 			p.area -= int64(text.sizeCurrent.Dx() * text.sizeCurrent.Dy())
-			text.pos = image.Pt(999999, 999999)
+			text.pos = unplaced
 		}
 	}
 }
@@ -529,20 +803,53 @@ func (p *Packer) clearBin(binIndex int) {
 func (p *Packer) recalculateDuplicates() {
 	for _, texture := range p.images.inputImages {
 		texture.duplicatedID = nil
+		texture.rank = texture.Priority
 	}
 
-	for i, texture := range p.images.inputImages {
-		for k := i + 1; k < len(p.images.inputImages); k++ {
-			textureK := p.images.inputImages[k]
-			if textureK.duplicatedID == nil &&
-				texture.hash == textureK.hash &&
-				texture.size.Eq(textureK.size) &&
-				texture.crop.Eq(textureK.size) {
-				textureK.duplicatedID = &texture.id
+	// the leaders are picked in the canonical order so the same image of
+	// the duplicates is packed whatever the order of the adding was
+	order := append([]*InputImage{}, p.images.inputImages...)
+	sort.SliceStable(order, func(i, j int) bool {
+		return canonicalLess(order[i], order[j])
+	})
+
+	leaders := map[uint64][]*InputImage{}
+	near := p.newNearDuplicates()
+	flips := p.newTransformedDuplicates()
+
+	for _, texture := range order {
+		texture.mergeError, texture.mergeDistance = 0, 0
+		texture.transform = TransformNone
+
+		var dup *InputImage
+		for _, leader := range leaders[texture.hash] {
+			if leader.size.Size().Eq(texture.size.Size()) &&
+				leader.crop.Sub(leader.size.Min).Eq(texture.crop.Sub(texture.size.Min)) &&
+				samePixels(leader.image, texture.image) {
+				dup = leader
+				break
 			}
 		}
+
+		if dup == nil && p.cfg.DedupTransforms && p.cfg.Merge {
+			dup, texture.transform = flips.find(texture)
+		}
+
+		if dup == nil && p.cfg.Dedup != DedupExact {
+			dup, texture.mergeError, texture.mergeDistance = near.find(texture)
+		}
+
+		if dup != nil {
+			texture.duplicatedID = &dup.id
+			dup.rank = max(dup.rank, texture.Priority)
+			continue
+		}
+		leaders[texture.hash] = append(leaders[texture.hash], texture)
+		near.add(texture)
+		if p.cfg.DedupTransforms {
+			flips.add(texture)
+		}
 	}
-	return
 }
 
 func (p *Packer) removeID(id int) {
@@ -603,14 +910,15 @@ type border struct {
 }
 
 // getID gets the nextID
-func (p *Packer) appendImage(i *InputImage) {
+func (p *Packer) appendImage(images ...*InputImage) {
 	p.lock.Lock()
 	defer p.lock.Unlock()
-	p.nextID++
-
-	i.id = p.nextID
-	p.images.inputImages = append(p.images.inputImages, i)
 
+	for _, i := range images {
+		p.nextID++
+		i.id = p.nextID
+		p.images.inputImages = append(p.images.inputImages, i)
+	}
 }
 
 // func (p *Packer) checkSumID(data []byte) uint64, int {
@@ -3,16 +3,32 @@
 package packer
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/disintegration/imaging"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
 	"image/jpeg"
+	"image/png"
 	"io/ioutil"
+	"math"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 // TestPacker tests the image packer
@@ -151,7 +167,7 @@ func TestPacker(t *testing.T) {
 
 			var poses = map[string]struct{}{}
 			for _, i := range images {
-				if i.pos.Eq(image.Pt(999999, 999999)) {
+				if !i.Placed() {
 					continue
 				}
 				_, ok := poses[i.pos.String()]
@@ -171,6 +187,1586 @@ func TestPacker(t *testing.T) {
 	})
 }
 
+// TestPlacement tests the bin placement
+func TestPlacement(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.TextureWidth, cfg.TextureHeight = 128, 128
+
+	t.Run("Retries", func(t *testing.T) {
+		// the halved last bins are too small, so the placements are restored
+		for _, rate := range []int{0, 1} {
+			p := New(cfg)
+			p.MinFillRate = rate
+			images := solidImages(t, p, image.Pt(100, 100), image.Pt(100, 100), image.Pt(100, 100))
+			require.NoError(t, p.Pack())
+
+			require.Len(t, p.OutputImages, 3)
+			pages := map[int]bool{}
+			for _, in := range images {
+				assert.Equal(t, image.ZP, in.PackedPosition())
+				assert.Equal(t, image.Rect(0, 0, 128, 128), p.OutputImages[in.TextureID()].Bounds())
+				pages[in.TextureID()] = true
+			}
+			assert.Len(t, pages, 3)
+		}
+	})
+
+	randomSizes := func(seed int64, n int) []image.Point {
+		rnd := rand.New(rand.NewSource(seed))
+		sizes := make([]image.Point, n)
+		for i := range sizes {
+			sizes[i] = image.Pt(4+rnd.Intn(28), 4+rnd.Intn(28))
+		}
+		return sizes
+	}
+
+	// slot gets the image region padded on every side
+	slot := func(in *InputImage, pad int) image.Rectangle {
+		size := in.Image().Bounds().Size().Add(image.Pt(2*pad, 2*pad))
+		return image.Rectangle{in.PackedPosition(), in.PackedPosition().Add(size)}
+	}
+	checkSlots := func(t *testing.T, p *Packer, images []*InputImage, pad int) {
+		for i, in := range images {
+			s := slot(in, pad)
+			require.True(t, s.In(p.OutputImages[in.TextureID()].Bounds()), "%v is outside of the page", s)
+			for _, o := range images[:i] {
+				if o.TextureID() == in.TextureID() {
+					require.False(t, s.Overlaps(slot(o, pad)), "%v overlaps %v", s, slot(o, pad))
+				}
+			}
+		}
+	}
+
+	t.Run("FreeRects", func(t *testing.T) {
+		p := New(cfg)
+		images := solidImages(t, p, randomSizes(1, 60)...)
+		require.NoError(t, p.Pack())
+		checkSlots(t, p, images, 0)
+	})
+
+	// checkBorder checks that the outer slot ring is empty
+	checkBorder := func(t *testing.T, p *Packer, images []*InputImage, pad int) {
+		for _, in := range images {
+			dst, s := p.OutputImages[in.TextureID()], slot(in, pad)
+			for x := s.Min.X; x < s.Max.X; x++ {
+				require.Equal(t, color.RGBA{}, dst.At(x, s.Min.Y))
+				require.Equal(t, color.RGBA{}, dst.At(x, s.Max.Y-1))
+			}
+			for y := s.Min.Y; y < s.Max.Y; y++ {
+				require.Equal(t, color.RGBA{}, dst.At(s.Min.X, y))
+				require.Equal(t, color.RGBA{}, dst.At(s.Max.X-1, y))
+			}
+		}
+	}
+
+	t.Run("Border", func(t *testing.T) {
+		cfg := *cfg
+		cfg.Border = 2
+		p := New(&cfg)
+		images := solidImages(t, p, randomSizes(2, 30)...)
+		require.NoError(t, p.Pack())
+		checkSlots(t, p, images, cfg.Border)
+		checkBorder(t, p, images, cfg.Border)
+	})
+
+	t.Run("Extrude", func(t *testing.T) {
+		cfg := *cfg
+		cfg.Border = 1
+		cfg.Extrude = 2
+		p := New(&cfg)
+		images := solidImages(t, p, randomSizes(3, 30)...)
+		require.NoError(t, p.Pack())
+		checkSlots(t, p, images, cfg.Border+cfg.Extrude)
+		checkBorder(t, p, images, cfg.Border+cfg.Extrude)
+
+		// the image and its extruded edges fill the slot within the border
+		for _, in := range images {
+			dst := p.OutputImages[in.TextureID()]
+			s := slot(in, cfg.Border+cfg.Extrude).Inset(cfg.Border)
+			want := color.RGBAModel.Convert(in.Image().At(0, 0))
+			for y := s.Min.Y; y < s.Max.Y; y++ {
+				for x := s.Min.X; x < s.Max.X; x++ {
+					require.Equal(t, want, dst.At(x, y))
+				}
+			}
+		}
+	})
+}
+
+// solidImages adds the solid color images named image_0, image_1 and so on
+func solidImages(t *testing.T, p *Packer, sizes ...image.Point) []*InputImage {
+	var images []*InputImage
+	for i, size := range sizes {
+		img := image.NewNRGBA(image.Rectangle{Max: size})
+		draw.Draw(img, img.Bounds(), &image.Uniform{color.NRGBA{R: uint8(i), A: 255}}, image.ZP, draw.Src)
+		in, err := p.AddImage(img)
+		require.NoError(t, err)
+		in.Name = fmt.Sprintf("image_%d", i)
+		images = append(images, in)
+	}
+	return images
+}
+
+// TestTrim tests the trim modes
+func TestTrim(t *testing.T) {
+	newImage := func(bg color.Color) *image.NRGBA {
+		img := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+		draw.Draw(img, img.Bounds(), &image.Uniform{bg}, image.ZP, draw.Src)
+		draw.Draw(img, image.Rect(3, 2, 15, 7), &image.Uniform{color.NRGBA{R: 10, G: 200, B: 30, A: 255}}, image.ZP, draw.Src)
+		return img
+	}
+
+	t.Run("Alpha", func(t *testing.T) {
+		p := New(DefaultConfig())
+		i, err := p.AddImage(newImage(color.Transparent))
+		require.NoError(t, err)
+		require.NoError(t, p.Pack())
+
+		assert.Equal(t, Trim{Left: 3, Top: 2, Right: 5, Bottom: 3}, i.Trim())
+		assert.Equal(t, color.RGBA{R: 10, G: 200, B: 30, A: 255}, p.OutputImages[0].At(i.PackedPosition().X, i.PackedPosition().Y))
+	})
+
+	t.Run("ColorKey", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.TrimMode = TrimColorKey
+		cfg.TrimColor = color.NRGBA{R: 255, B: 255, A: 255}
+		cfg.TrimTolerance = 2
+
+		p := New(cfg)
+		i, err := p.AddImage(newImage(color.NRGBA{R: 254, B: 255, A: 255}))
+		require.NoError(t, err)
+		require.NoError(t, p.Pack())
+		assert.Equal(t, Trim{Left: 3, Top: 2, Right: 5, Bottom: 3}, i.Trim())
+	})
+
+	t.Run("Margin", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.TrimMode = TrimColorKey
+		cfg.TrimMargin = 4
+
+		p := New(cfg)
+		i, err := p.AddImage(newImage(color.White))
+		require.NoError(t, err)
+		require.NoError(t, p.Pack())
+		assert.Equal(t, Trim{Left: 0, Top: 0, Right: 1, Bottom: 0}, i.Trim())
+	})
+	// the trimmed regions are drawn with their own borders and extrusion
+	// and packed to the free rectangles without overlapping
+	t.Run("Placement", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Border = 1
+		cfg.Extrude = 2
+		cfg.TextureWidth, cfg.TextureHeight = 128, 128
+		p := New(cfg)
+
+		rnd := rand.New(rand.NewSource(26))
+		for i := 0; i < 40; i++ {
+			w, h := 6+rnd.Intn(20), 6+rnd.Intn(20)
+			img := image.NewNRGBA(image.Rect(0, 0, w+4, h+4))
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					img.SetNRGBA(2+x, 1+y, color.NRGBA{R: uint8(i), G: uint8(x), B: uint8(y), A: 255})
+				}
+			}
+			in, err := p.AddImage(img)
+			require.NoError(t, err)
+			in.Name = fmt.Sprintf("trimmed_%02d", i)
+		}
+		require.NoError(t, p.Pack())
+
+		pad := cfg.Border + cfg.Extrude
+		frames := p.Result().Frames
+		for i, f := range frames {
+			dst := p.OutputImages[f.TextureID].Image
+			slot := f.Rect.Inset(-pad)
+			require.True(t, slot.In(dst.Bounds()), f.Image.Name)
+			for _, o := range frames[:i] {
+				if o.TextureID == f.TextureID {
+					require.False(t, slot.Overlaps(o.Rect.Inset(-pad)), "%s overlaps %s", f.Image.Name, o.Image.Name)
+				}
+			}
+
+			src := f.Image.Image()
+			r := f.Rect.Inset(-cfg.Extrude)
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				for x := r.Min.X; x < r.Max.X; x++ {
+					// the extruded pixels repeat the nearest edge pixel
+					cx := min(max(x, f.Rect.Min.X), f.Rect.Max.X-1) - f.Rect.Min.X + f.Trim.Left
+					cy := min(max(y, f.Rect.Min.Y), f.Rect.Max.Y-1) - f.Rect.Min.Y + f.Trim.Top
+					require.Equal(t, color.NRGBAModel.Convert(src.At(cx, cy)), color.NRGBAModel.Convert(dst.At(x, y)), f.Image.Name)
+				}
+			}
+
+			// the border is left empty on all the sides
+			for x := slot.Min.X; x < slot.Max.X; x++ {
+				require.Equal(t, color.RGBA{}, dst.At(x, slot.Min.Y), f.Image.Name)
+				require.Equal(t, color.RGBA{}, dst.At(x, slot.Max.Y-1), f.Image.Name)
+			}
+			for y := slot.Min.Y; y < slot.Max.Y; y++ {
+				require.Equal(t, color.RGBA{}, dst.At(slot.Min.X, y), f.Image.Name)
+				require.Equal(t, color.RGBA{}, dst.At(slot.Max.X-1, y), f.Image.Name)
+			}
+		}
+	})
+}
+
+// TestDuplicates tests the duplicate detection
+func TestDuplicates(t *testing.T) {
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	draw.Draw(nrgba, image.Rect(2, 2, 12, 14), &image.Uniform{color.NRGBA{R: 255, A: 255}}, image.ZP, draw.Src)
+
+	rgba := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	draw.Draw(rgba, rgba.Bounds(), nrgba, image.ZP, draw.Src)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, png.Encode(buf, nrgba))
+
+	t.Run("Pixels", func(t *testing.T) {
+		p := New(DefaultConfig())
+		i1, err := p.AddImage(nrgba)
+		require.NoError(t, err)
+		i2, err := p.AddImage(rgba)
+		require.NoError(t, err)
+		i3, err := p.AddImageBytes(buf.Bytes())
+		require.NoError(t, err)
+		require.NoError(t, p.Pack())
+
+		assert.Equal(t, i1.Hash(), i2.Hash())
+		assert.Equal(t, i1.Hash(), i3.Hash())
+		assert.Equal(t, 2, p.mergedImages)
+		assert.Equal(t, i1.PackedPosition(), i3.PackedPosition())
+	})
+
+	t.Run("Collision", func(t *testing.T) {
+		other := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+		draw.Draw(other, image.Rect(2, 2, 12, 14), &image.Uniform{color.NRGBA{G: 255, A: 255}}, image.ZP, draw.Src)
+
+		p := New(DefaultConfig())
+		i1, err := p.AddImage(nrgba, 1)
+		require.NoError(t, err)
+		i2, err := p.AddImage(other, 1)
+		require.NoError(t, err)
+		require.NoError(t, p.Pack())
+
+		assert.Equal(t, 0, p.mergedImages)
+		assert.NotEqual(t, i1.PackedPosition(), i2.PackedPosition())
+	})
+}
+
+// TestNearDuplicates tests the near-duplicate merging
+func TestNearDuplicates(t *testing.T) {
+	frame := func(noise uint8, shift int) *image.NRGBA {
+		img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 16; x++ {
+				img.SetNRGBA(4+shift+x, 4+y, color.NRGBA{R: uint8(16 * x), G: uint8(16 * y), B: 100, A: 255})
+			}
+		}
+		img.SetNRGBA(10+shift, 10, color.NRGBA{R: 160 + noise, G: 96, B: 100, A: 255})
+		return img
+	}
+
+	for _, mode := range []DedupMode{DedupTolerance, DedupPerceptual} {
+		cfg := DefaultConfig()
+		cfg.Dedup = mode
+		cfg.DedupTolerance = 8
+		cfg.DedupDistance = 2
+
+		p := New(cfg)
+		i1, err := p.AddImage(frame(0, 0))
+		require.NoError(t, err)
+		i2, err := p.AddImage(frame(6, 3))
+		require.NoError(t, err)
+		i3, err := p.AddImage(frame(0, 0))
+		require.NoError(t, err)
+		i1.Name, i2.Name, i3.Name = "frame_0", "frame_1", "frame_2"
+		require.NoError(t, p.Pack())
+
+		res := p.Result()
+		require.Len(t, res.Merged, 2)
+		assert.Equal(t, 6, res.MaxError)
+		assert.Equal(t, i1, res.Merged[0].Into)
+		assert.Equal(t, i1.PackedPosition(), i2.PackedPosition())
+		assert.Equal(t, Trim{Left: 7, Top: 4, Right: 9, Bottom: 12}, i2.Trim())
+	}
+}
+
+// TestVariants tests the scaled atlas variants
+func TestVariants(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Border = 1
+	cfg.Scales = []float64{1, 2, 0.5}
+	cfg.ScaleFilter = imaging.NearestNeighbor
+	p := New(cfg)
+
+	for i := 1; i <= 20; i++ {
+		img := image.NewNRGBA(image.Rect(0, 0, 3*i, 40-i))
+		draw.Draw(img, image.Rect(1, 1, 3*i, 40-i), &image.Uniform{color.NRGBA{R: uint8(10 * i), A: 255}}, image.ZP, draw.Src)
+		_, err := p.AddImage(img)
+		require.NoError(t, err)
+	}
+	require.NoError(t, p.Pack())
+
+	res := p.Result()
+	require.Len(t, res.Variants, 3)
+	assert.Equal(t, p.OutputImages, res.Variants[0].OutputImages)
+
+	for _, v := range res.Variants {
+		require.Len(t, v.Frames, len(res.Frames))
+		for i, f := range v.Frames {
+			base := res.Frames[i]
+			assert.Equal(t, base.Image, f.Image)
+			assert.True(t, f.Rect.In(v.OutputImages[f.TextureID].Bounds()))
+			assert.Equal(t, image.Pt(int(math.Ceil(float64(base.SourceSize.X)*v.Scale)), int(math.Ceil(float64(base.SourceSize.Y)*v.Scale))), f.SourceSize)
+
+			for _, o := range v.Frames[:i] {
+				assert.False(t, o.TextureID == f.TextureID && o.Rect.Overlaps(f.Rect))
+			}
+		}
+	}
+
+	// the doubled layout keeps the positions
+	for i, f := range res.Variants[1].Frames {
+		base := res.Frames[i]
+		assert.Equal(t, base.Rect.Min.Sub(image.Pt(1, 1)).Mul(2), f.Rect.Min.Sub(image.Pt(1, 1)))
+		assert.Equal(t, Trim{Left: 2, Top: 2}, f.Trim)
+		assert.Equal(t, color.RGBA{R: uint8(base.SourceSize.X / 3 * 10), A: 255}, res.Variants[1].OutputImages[f.TextureID].At(f.Rect.Min.X, f.Rect.Min.Y))
+	}
+
+	// the pages of the variants are exported with their scales
+	for _, v := range res.Variants {
+		var buf bytes.Buffer
+		require.NoError(t, p.WriteVariantJSON(&buf, v, 0, "atlas.png"))
+		var atlas struct {
+			Frames map[string]struct {
+				Frame struct{ X, Y, W, H int }
+			}
+			Meta struct{ Scale string }
+		}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &atlas))
+		assert.Equal(t, strconv.FormatFloat(v.Scale, 'g', -1, 64), atlas.Meta.Scale)
+		for _, f := range v.Frames {
+			if f.TextureID == 0 {
+				assert.Equal(t, f.Rect.Min.X, atlas.Frames[frameName(f.Image)].Frame.X)
+			}
+		}
+		assert.Equal(t, ErrInvalidPage, p.WriteVariantJSON(&buf, v, len(v.OutputImages), "atlas.png"))
+	}
+
+	// the images overflowing the maximum page at the scale are reported
+	for _, strict := range []bool{false, true} {
+		cfg := DefaultConfig()
+		cfg.MaxTextureWidth, cfg.MaxTextureHeight = 256, 256
+		cfg.Scales = []float64{2}
+		cfg.Strict = strict
+		p := New(cfg)
+		img := image.NewNRGBA(image.Rect(0, 0, 200, 200))
+		draw.Draw(img, img.Bounds(), &image.Uniform{color.NRGBA{G: 255, A: 255}}, image.ZP, draw.Src)
+		in, err := p.AddImage(img)
+		require.NoError(t, err)
+
+		err = p.Pack()
+		res := p.Result()
+		require.Len(t, res.Variants, 1)
+		v := res.Variants[0]
+		assert.Empty(t, v.Frames)
+		require.Len(t, v.Unplaced, 1)
+		assert.Same(t, in, v.Unplaced[0].Image)
+		var tooLarge *ImageTooLargeError
+		require.True(t, errors.As(v.Unplaced[0].Err, &tooLarge))
+		assert.Same(t, in, tooLarge.Image)
+		assert.Equal(t, v.Unplaced, res.Unplaced)
+
+		if !strict {
+			assert.NoError(t, err)
+			continue
+		}
+		var unplacedErr *UnplacedError
+		require.True(t, errors.As(err, &unplacedErr))
+		assert.Equal(t, res.Unplaced, unplacedErr.Images)
+	}
+}
+
+// TestSizePolicy tests the bin size policies
+func TestSizePolicy(t *testing.T) {
+	var sizes []image.Point
+	for i := 1; i <= 30; i++ {
+		sizes = append(sizes, image.Pt(3+i, 33-i))
+	}
+	newPacker := func(cfg *Config) *Packer {
+		p := New(cfg)
+		solidImages(t, p, sizes...)
+		return p
+	}
+
+	t.Run("POT", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.TextureWidth, cfg.TextureHeight = 300, 200
+		cfg.SizePolicy = SizePOT
+		p := newPacker(cfg)
+		require.NoError(t, p.Pack())
+
+		for _, bin := range p.bins {
+			assert.Equal(t, nextPOT(bin.Dx()), bin.Dx())
+			assert.Equal(t, nextPOT(bin.Dy()), bin.Dy())
+		}
+	})
+
+	t.Run("Blocks", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.TextureWidth, cfg.TextureHeight = 301, 201
+		cfg.SizePolicy = SizeMultiple
+		cfg.SizeMultiple = 4
+		cfg.Alignment = 4
+		p := newPacker(cfg)
+		require.NoError(t, p.Pack())
+
+		for _, bin := range p.bins {
+			assert.Zero(t, bin.Dx()%4)
+			assert.Zero(t, bin.Dy()%4)
+		}
+
+		for _, f := range p.Result().Frames {
+			assert.Zero(t, f.Rect.Min.X%4)
+			assert.Zero(t, f.Rect.Min.Y%4)
+			for _, o := range p.Result().Frames {
+				if o != f && o.TextureID == f.TextureID {
+					// no 4x4 block is shared by two images
+					blocks := func(r image.Rectangle) image.Rectangle {
+						return image.Rect(r.Min.X/4, r.Min.Y/4, (r.Max.X+3)/4, (r.Max.Y+3)/4)
+					}
+					assert.False(t, blocks(o.Rect).Overlaps(blocks(f.Rect)))
+				}
+			}
+		}
+	})
+}
+
+// TestShrinkToFit tests the bin shrinking
+func TestShrinkToFit(t *testing.T) {
+	pack := func(cfg *Config) *Packer {
+		p := New(cfg)
+		size := image.Pt(100, 100)
+		solidImages(t, p, size, size, size, size, size, size, size, size, size)
+		require.NoError(t, p.Pack())
+		return p
+	}
+
+	cfg := DefaultConfig()
+	cfg.TextureWidth, cfg.TextureHeight = 1024, 1024
+	p := pack(cfg)
+	require.Len(t, p.bins, 1)
+	assert.Equal(t, image.Rect(0, 0, 512, 512), p.bins[0])
+
+	cfg.ShrinkToFit = true
+	p = pack(cfg)
+	require.Len(t, p.bins, 1)
+	assert.Equal(t, image.Rect(0, 0, 300, 300), p.bins[0])
+	assert.Equal(t, p.bins[0], p.OutputImages[0].Bounds())
+
+	cfg.Square = false
+	cfg.SizePolicy = SizeMultiple
+	cfg.SizeMultiple = 64
+	p = pack(cfg)
+	assert.Equal(t, image.Rect(0, 0, 512, 256), p.bins[0])
+}
+
+// TestMaxSize tests the maximum page size
+func TestMaxSize(t *testing.T) {
+	newPacker := func(cfg *Config, sizes ...int) *Packer {
+		p := New(cfg)
+		var points []image.Point
+		for _, size := range sizes {
+			points = append(points, image.Pt(size, size))
+		}
+		solidImages(t, p, points...)
+		return p
+	}
+
+	t.Run("TooLarge", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.AutoGrow = true
+		cfg.Strict = true
+		cfg.MaxTextureWidth, cfg.MaxTextureHeight = 256, 256
+		p := newPacker(cfg, 100, 300)
+
+		err := p.Pack()
+		require.True(t, errors.Is(err, ErrImageTooLarge))
+
+		var tooLarge *ImageTooLargeError
+		require.True(t, errors.As(err, &tooLarge))
+		assert.Equal(t, "image_1", tooLarge.Name)
+		assert.Equal(t, image.Pt(300, 300), tooLarge.Size)
+		assert.Equal(t, image.Pt(256, 256), tooLarge.Max)
+
+		cfg.AutoGrow = false
+		cfg.TextureWidth, cfg.TextureHeight = 200, 200
+		require.True(t, errors.Is(newPacker(cfg, 100, 250).Pack(), ErrImageTooLarge))
+	})
+
+	t.Run("Exceeded", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.AutoGrow = true
+		cfg.TextureWidth, cfg.TextureHeight = 64, 64
+		cfg.MaxTextureWidth, cfg.MaxTextureHeight = 256, 256
+		cfg.Strict = true
+		require.True(t, errors.Is(newPacker(cfg, 200, 200).Pack(), ErrMaxSizeExceeded))
+
+		cfg.Strict = false
+		p := newPacker(cfg, 200, 200)
+		require.NoError(t, p.Pack())
+		require.Len(t, p.Result().Unplaced, 1)
+		assert.Equal(t, ErrMaxSizeExceeded, p.Result().Unplaced[0].Err)
+
+		cfg.SpillPages = true
+		p = newPacker(cfg, 200, 200, 200)
+		require.NoError(t, p.Pack())
+		assert.Len(t, p.OutputImages, 3)
+		for _, bin := range p.bins {
+			assert.True(t, bin.In(image.Rect(0, 0, 256, 256)))
+		}
+	})
+}
+
+// TestUnplaced tests the unplaced image reporting
+func TestUnplaced(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.TextureWidth, cfg.TextureHeight = 128, 128
+
+	p := New(cfg)
+	images := solidImages(t, p, image.Pt(100, 100), image.Pt(200, 200), image.Pt(50, 50), image.Pt(200, 200))
+
+	require.NoError(t, p.Pack())
+	assert.True(t, images[0].Placed())
+	assert.False(t, images[1].Placed())
+	assert.True(t, images[2].Placed())
+	assert.False(t, images[3].Placed())
+
+	unplaced := p.Result().Unplaced
+	require.Len(t, unplaced, 2)
+	for _, u := range unplaced {
+		assert.True(t, errors.Is(u.Err, ErrImageTooLarge))
+	}
+	assert.Len(t, p.Result().Frames, 2)
+
+	cfg.Strict = true
+	err := p.Pack()
+	var unplacedErr *UnplacedError
+	require.True(t, errors.As(err, &unplacedErr))
+	assert.Len(t, unplacedErr.Images, 2)
+	assert.Contains(t, err.Error(), "image_1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p = NewCtx(ctx, cfg)
+	_, err = p.AddImage(image.NewNRGBA(image.Rect(0, 0, 10, 10)))
+	require.NoError(t, err)
+	require.Equal(t, context.Canceled, p.Pack())
+	require.Len(t, p.Result().Unplaced, 1)
+	assert.Equal(t, context.Canceled, p.Result().Unplaced[0].Err)
+}
+
+// TestMaxPages tests the page count limit
+func TestMaxPages(t *testing.T) {
+	newPacker := func(cfg *Config) *Packer {
+		p := New(cfg)
+		size := image.Pt(60, 60)
+		solidImages(t, p, size, size, size, size, size, size)
+		return p
+	}
+
+	cfg := DefaultConfig()
+	cfg.TextureWidth, cfg.TextureHeight = 128, 128
+	cfg.MaxPages = 1
+
+	t.Run("Fail", func(t *testing.T) {
+		cfg := *cfg
+		err := newPacker(&cfg).Pack()
+		require.True(t, errors.Is(err, ErrPageLimit))
+	})
+
+	t.Run("Drop", func(t *testing.T) {
+		cfg := *cfg
+		cfg.Overflow = OverflowDrop
+		p := newPacker(&cfg)
+		require.NoError(t, p.Pack())
+		assert.Len(t, p.OutputImages, 1)
+		assert.Len(t, p.Result().Dropped, 2)
+		assert.Len(t, p.Result().Frames, 4)
+	})
+
+	t.Run("Downscale", func(t *testing.T) {
+		cfg := *cfg
+		cfg.Overflow = OverflowDownscale
+		p := newPacker(&cfg)
+		require.NoError(t, p.Pack())
+		assert.Len(t, p.OutputImages, 1)
+		assert.Len(t, p.Result().Frames, 6)
+		require.NotEmpty(t, p.Result().Downscaled)
+		for _, f := range p.Result().Frames {
+			assert.True(t, f.Scale < 1)
+			assert.Equal(t, f.Rect.Size(), f.SourceSize)
+		}
+
+		cfg.MinDownscale = 0.9
+		require.True(t, errors.Is(newPacker(&cfg).Pack(), ErrPageLimit))
+	})
+}
+
+// TestPriority tests the image priorities
+func TestPriority(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.TextureWidth, cfg.TextureHeight = 128, 128
+
+	p := New(cfg)
+	var inputs []*InputImage
+	for i := 0; i < 6; i++ {
+		img := image.NewNRGBA(image.Rect(0, 0, 60, 50+i))
+		draw.Draw(img, img.Bounds(), &image.Uniform{color.NRGBA{G: uint8(i), A: 255}}, image.ZP, draw.Src)
+		in, err := p.AddImage(img)
+		require.NoError(t, err)
+		in.Name = fmt.Sprintf("image_%d", i)
+		inputs = append(inputs, in)
+	}
+	inputs[0].Priority = 10
+	inputs[1].Priority = 5
+
+	require.NoError(t, p.Pack())
+	assert.Equal(t, 0, inputs[0].TextureID())
+	assert.Equal(t, 0, inputs[1].TextureID())
+	assert.Equal(t, 1, inputs[2].TextureID())
+	assert.Equal(t, 1, inputs[3].TextureID())
+
+	cfg.MaxPages = 1
+	cfg.Overflow = OverflowDrop
+	require.NoError(t, p.Pack())
+	for _, img := range p.Result().Dropped {
+		assert.Zero(t, img.Priority)
+	}
+	assert.True(t, inputs[0].Placed())
+	assert.True(t, inputs[1].Placed())
+}
+
+// TestDeterministic tests the add order independence
+func TestDeterministic(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	var sources []image.Image
+	for i := 0; i < 40; i++ {
+		img := image.NewNRGBA(image.Rect(0, 0, 8+rnd.Intn(4)*8, 8+rnd.Intn(4)*8))
+		c := color.NRGBA{R: uint8(rnd.Intn(4)), G: uint8(i), A: 255}
+		if i%5 == 0 {
+			// the duplicates of the same size and color
+			c.G = 0
+		}
+		draw.Draw(img, img.Bounds(), &image.Uniform{c}, image.ZP, draw.Src)
+		sources = append(sources, img)
+	}
+
+	pack := func(order []int, named bool) []*OutputImage {
+		cfg := DefaultConfig()
+		cfg.TextureWidth, cfg.TextureHeight = 64, 64
+		p := New(cfg)
+
+		// the require must not be called from the goroutines
+		errs := make([]error, len(sources))
+		var wg sync.WaitGroup
+		for _, i := range order {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				in, err := p.AddImage(sources[i])
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				if named {
+					in.Name = fmt.Sprintf("image_%02d", i)
+				}
+			}(i)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			require.NoError(t, err)
+		}
+
+		if !named {
+			// the colliding hashes leave only the pixels to order by
+			for _, in := range p.images.inputImages {
+				in.hash = 0
+			}
+		}
+
+		require.NoError(t, p.Pack())
+		return p.OutputImages
+	}
+
+	for _, named := range []bool{true, false} {
+		expected := pack(rnd.Perm(len(sources)), named)
+		for run := 0; run < 5; run++ {
+			actual := pack(rnd.Perm(len(sources)), named)
+			require.Len(t, actual, len(expected))
+			for i := range expected {
+				b := expected[i].Image.Bounds()
+				require.Equal(t, b, actual[i].Image.Bounds())
+				for y := b.Min.Y; y < b.Max.Y; y++ {
+					for x := b.Min.X; x < b.Max.X; x++ {
+						require.Equal(t, expected[i].Image.At(x, y), actual[i].Image.At(x, y), "named %t page %d at %d,%d", named, i, x, y)
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestAddImages tests the parallel image loading
+func TestAddImages(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		img := image.NewNRGBA(image.Rect(0, 0, 10+i, 10))
+		draw.Draw(img, img.Bounds(), &image.Uniform{color.NRGBA{R: uint8(i), A: 255}}, image.ZP, draw.Src)
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, img))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("frame_%02d.png", i)), buf.Bytes(), 0644))
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "broken.png"), []byte("broken"), 0644))
+
+	cfg := DefaultConfig()
+	cfg.Workers = 4
+	p := New(cfg)
+
+	images, err := p.AddDir(context.Background(), dir)
+	var loadErr *LoadError
+	require.True(t, errors.As(err, &loadErr))
+	require.Len(t, loadErr.Sources, 1)
+	assert.Equal(t, "broken", loadErr.Sources[0].Name)
+	assert.True(t, errors.Is(err, image.ErrFormat))
+
+	require.Len(t, images, 20)
+	for i, img := range images {
+		assert.Equal(t, fmt.Sprintf("frame_%02d", i), img.Name)
+		assert.Equal(t, 10+i, img.Bounds().Dx())
+		if i > 0 {
+			assert.Equal(t, images[i-1].id+1, img.id)
+		}
+	}
+	require.NoError(t, p.Pack())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p = New(cfg)
+	images, err = p.AddDir(ctx, dir)
+	assert.Equal(t, context.Canceled, err)
+	assert.Empty(t, images)
+	assert.Empty(t, p.images.inputImages)
+}
+
+// TestAddFS tests the file system loading
+func TestAddFS(t *testing.T) {
+	encode := func(w int) []byte {
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, w, 10))))
+		return buf.Bytes()
+	}
+	fsys := fstest.MapFS{
+		"units/hero/idle.png": {Data: encode(10)},
+		"units/hero/run.png":  {Data: encode(12)},
+		"ui/button.png":       {Data: encode(14)},
+		"readme.txt":          {Data: []byte("readme")},
+	}
+
+	names := func(images []*InputImage) []string {
+		var names []string
+		for _, img := range images {
+			names = append(names, img.Name)
+		}
+		return names
+	}
+
+	images, err := New(nil).AddFS(fsys, "*.png")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ui/button", "units/hero/idle", "units/hero/run"}, names(images))
+
+	cfg := DefaultConfig()
+	cfg.KeepExtension = true
+	cfg.PathSeparator = "_"
+	images, err = New(cfg).AddFS(fsys, "units/*/*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"units_hero_idle.png", "units_hero_run.png"}, names(images))
+
+	_, err = New(nil).AddFS(fsys, "[")
+	assert.Error(t, err)
+}
+
+// TestSlice tests the sprite sheet slicing
+func TestSlice(t *testing.T) {
+	fill := func(img *image.NRGBA, r image.Rectangle, c uint8) {
+		draw.Draw(img, r, &image.Uniform{color.NRGBA{R: c, A: 255}}, image.ZP, draw.Src)
+	}
+
+	t.Run("Grid", func(t *testing.T) {
+		sheet := image.NewNRGBA(image.Rect(0, 0, 2+3*8+2*1+2, 2+2*8+1+2))
+		for i := 0; i < 6; i++ {
+			x, y := 2+i%3*9, 2+i/3*9
+			fill(sheet, image.Rect(x, y, x+8, y+8), uint8(10*i+10))
+		}
+
+		p := New(nil)
+		images, err := p.AddGrid(sheet, "walk", Grid{CellWidth: 8, CellHeight: 8, Margin: 2, Spacing: 1, Count: 5})
+		require.NoError(t, err)
+		require.Len(t, images, 5)
+		assert.Equal(t, "walk_004", images[4].Name)
+		assert.Equal(t, image.Pt(11, 11), images[4].Offset())
+		assert.Equal(t, color.NRGBA{R: 50, A: 255}, color.NRGBAModel.Convert(images[4].Image().At(0, 0)))
+		assert.Equal(t, image.Rect(0, 0, 8, 8), images[4].Bounds())
+
+		_, err = p.AddGrid(sheet, "walk", Grid{})
+		assert.Equal(t, ErrInvalidGrid, err)
+	})
+
+	t.Run("Islands", func(t *testing.T) {
+		sheet := image.NewNRGBA(image.Rect(0, 0, 64, 32))
+		fill(sheet, image.Rect(30, 2, 40, 12), 10)
+		fill(sheet, image.Rect(2, 4, 12, 14), 20)
+		fill(sheet, image.Rect(2, 16, 12, 18), 30)
+		fill(sheet, image.Rect(50, 20, 51, 21), 40)
+
+		images, err := New(nil).AddIslands(sheet, "sprite", Islands{Gap: 3, MinSize: 2})
+		require.NoError(t, err)
+		require.Len(t, images, 2)
+		assert.Equal(t, "sprite_000", images[0].Name)
+		assert.Equal(t, image.Pt(30, 2), images[0].Offset())
+		assert.Equal(t, image.Pt(2, 4), images[1].Offset())
+		assert.Equal(t, image.Pt(10, 14), images[1].Bounds().Size())
+	})
+}
+
+// TestAnimation tests the animated image frames
+func TestAnimation(t *testing.T) {
+	palette := color.Palette{color.Transparent, color.NRGBA{R: 255, A: 255}, color.NRGBA{B: 255, A: 255}}
+	frame := func(r image.Rectangle, c uint8) *image.Paletted {
+		img := image.NewPaletted(r, palette)
+		draw.Draw(img, r, &image.Uniform{palette[c]}, image.ZP, draw.Src)
+		return img
+	}
+
+	check := func(t *testing.T, images []*InputImage, delays ...time.Duration) {
+		require.Len(t, images, 3)
+		assert.Equal(t, "anim_002", images[2].Name)
+		for i, img := range images {
+			assert.Equal(t, delays[i], img.Duration)
+			assert.Equal(t, image.Rect(0, 0, 8, 8), img.Bounds())
+		}
+		// the second frame is drawn over the first one
+		assert.Equal(t, color.NRGBA{R: 255, A: 255}, color.NRGBAModel.Convert(images[1].Image().At(0, 0)))
+		assert.Equal(t, color.NRGBA{B: 255, A: 255}, color.NRGBAModel.Convert(images[1].Image().At(4, 4)))
+		// the third frame restores the first one
+		assert.Equal(t, color.NRGBA{R: 255, A: 255}, color.NRGBAModel.Convert(images[2].Image().At(4, 4)))
+	}
+
+	t.Run("GIF", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, gif.EncodeAll(&buf, &gif.GIF{
+			Image: []*image.Paletted{
+				frame(image.Rect(0, 0, 8, 8), 1),
+				frame(image.Rect(2, 2, 6, 6), 2),
+				frame(image.Rect(0, 0, 1, 1), 0),
+			},
+			Delay:    []int{10, 20, 30},
+			Disposal: []byte{gif.DisposalNone, gif.DisposalPrevious, gif.DisposalNone},
+		}))
+
+		p := New(nil)
+		images, err := p.AddAnimation(&buf, "anim")
+		require.NoError(t, err)
+		check(t, images, 100*time.Millisecond, 200*time.Millisecond, 300*time.Millisecond)
+
+		require.NoError(t, p.Pack())
+		require.Len(t, p.Result().Merged, 1)
+		assert.Equal(t, images[0], p.Result().Merged[0].Into)
+	})
+
+	t.Run("APNG", func(t *testing.T) {
+		chunk := func(typ string, data []byte) []byte {
+			var buf bytes.Buffer
+			writePNGChunk(&buf, typ, data)
+			return buf.Bytes()
+		}
+		idat := func(img image.Image) []byte {
+			var buf bytes.Buffer
+			require.NoError(t, png.Encode(&buf, img))
+			data := buf.Bytes()[8:]
+			for len(data) > 0 {
+				n := binary.BigEndian.Uint32(data)
+				if string(data[4:8]) == "IDAT" {
+					return data[8 : 8+n]
+				}
+				data = data[12+n:]
+			}
+			return nil
+		}
+		fctl := func(seq uint32, r image.Rectangle, delay uint16, dispose, blend byte) []byte {
+			b := make([]byte, 26)
+			for i, v := range []int{int(seq), r.Dx(), r.Dy(), r.Min.X, r.Min.Y} {
+				binary.BigEndian.PutUint32(b[4*i:], uint32(v))
+			}
+			binary.BigEndian.PutUint16(b[20:], delay)
+			binary.BigEndian.PutUint16(b[22:], 1000)
+			b[24], b[25] = dispose, blend
+			return chunk("fcTL", b)
+		}
+		fdat := func(seq uint32, img image.Image) []byte {
+			b := make([]byte, 4)
+			binary.BigEndian.PutUint32(b, seq)
+			return chunk("fdAT", append(b, idat(img)...))
+		}
+
+		// the header, palette and transparency chunks of the paletted frames
+		var base bytes.Buffer
+		require.NoError(t, png.Encode(&base, frame(image.Rect(0, 0, 8, 8), 0)))
+		head := base.Bytes()[:bytes.Index(base.Bytes(), []byte("IDAT"))-4]
+
+		var buf bytes.Buffer
+		buf.Write(head)
+		buf.Write(chunk("acTL", []byte{0, 0, 0, 3, 0, 0, 0, 0}))
+		buf.Write(fctl(0, image.Rect(0, 0, 8, 8), 50, apngDisposeNone, 0))
+		buf.Write(chunk("IDAT", idat(frame(image.Rect(0, 0, 8, 8), 1))))
+		buf.Write(fctl(1, image.Rect(2, 2, 6, 6), 60, apngDisposePrevious, apngBlendOver))
+		buf.Write(fdat(2, frame(image.Rect(0, 0, 4, 4), 2)))
+		buf.Write(fctl(3, image.Rect(0, 0, 1, 1), 70, apngDisposeNone, apngBlendOver))
+		buf.Write(fdat(4, frame(image.Rect(0, 0, 1, 1), 0)))
+		buf.Write(chunk("IEND", nil))
+
+		images, err := New(nil).AddAnimation(&buf, "anim")
+		require.NoError(t, err)
+		check(t, images, 50*time.Millisecond, 60*time.Millisecond, 70*time.Millisecond)
+	})
+}
+
+// TestAnimations tests the sequence grouping
+func TestAnimations(t *testing.T) {
+	encode := func(c uint8) []byte {
+		img := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		draw.Draw(img, img.Bounds(), &image.Uniform{color.NRGBA{R: c, A: 255}}, image.ZP, draw.Src)
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, img))
+		return buf.Bytes()
+	}
+	fsys := fstest.MapFS{
+		"walk_0002.png":  {Data: encode(2)},
+		"walk_0010.png":  {Data: encode(10)},
+		"walk_0001.png":  {Data: encode(1)},
+		"idle_1.png":     {Data: encode(20)},
+		"icon.png":       {Data: encode(30)},
+		"walk.anim.json": {Data: []byte(`{"duration": 80, "durations": [200], "loop": "pingpong"}`)},
+		"idle.anim.json": {Data: []byte(`{"duration": "slow"}`)},
+	}
+
+	// the sidecars are loaded only when they match the patterns
+	p := New(nil)
+	_, err := p.AddFS(fsys, "*.png")
+	require.NoError(t, err)
+	assert.Empty(t, p.timings)
+
+	// the frames are grouped only with the pattern
+	require.NoError(t, p.Pack())
+	assert.Empty(t, p.Result().Animations)
+
+	// the broken sidecar is reported and the rest is loaded
+	cfg := DefaultConfig()
+	cfg.SequencePattern = DefaultSequencePattern
+	p = New(cfg)
+	images, err := p.AddFS(fsys, "*.png", "*.anim.json")
+	var loadErr *LoadError
+	require.True(t, errors.As(err, &loadErr))
+	require.Len(t, loadErr.Sources, 1)
+	assert.Equal(t, "idle.anim.json", loadErr.Sources[0].Name)
+	assert.Len(t, images, 5)
+	require.NoError(t, p.Pack())
+
+	require.Len(t, p.Result().Animations, 1)
+	a := p.Result().Animations[0]
+	assert.Equal(t, "walk", a.Name)
+	assert.Equal(t, LoopPingPong, a.Loop)
+	require.Len(t, a.Frames, 3)
+	for i, name := range []string{"walk_0001", "walk_0002", "walk_0010"} {
+		assert.Equal(t, name, a.Frames[i].Image.Name)
+	}
+	assert.Equal(t, []time.Duration{200 * time.Millisecond, 80 * time.Millisecond, 80 * time.Millisecond}, a.Durations)
+
+	var buf bytes.Buffer
+	require.NoError(t, p.WriteJSON(&buf, 0, "atlas.png"))
+	var atlas struct {
+		Frames     map[string]json.RawMessage
+		Animations map[string][]string
+		Meta       struct {
+			Image      string
+			Animations map[string]struct {
+				Durations []float64
+				Loop      string
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &atlas))
+	assert.Len(t, atlas.Frames, 5)
+	assert.Equal(t, "atlas.png", atlas.Meta.Image)
+	assert.Equal(t, []string{"walk_0001", "walk_0002", "walk_0010"}, atlas.Animations["walk"])
+	assert.Equal(t, []float64{200, 80, 80}, atlas.Meta.Animations["walk"].Durations)
+	assert.Equal(t, "pingpong", atlas.Meta.Animations["walk"].Loop)
+
+	assert.Equal(t, ErrInvalidPage, p.WriteJSON(&buf, 1, "atlas.png"))
+}
+
+// TestPivot tests the frame pivots
+func TestPivot(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 30))
+	draw.Draw(img, image.Rect(4, 6, 14, 26), &image.Uniform{color.NRGBA{G: 255, A: 255}}, image.ZP, draw.Src)
+	img.SetNRGBA(9, 25, color.NRGBA{R: 255, A: 255})
+
+	for _, rotate := range []Rotation{RNever, RHeightGreaterWidth} {
+		cfg := DefaultConfig()
+		cfg.Rotation = rotate
+		p := New(cfg)
+		in, err := p.AddImage(img)
+		require.NoError(t, err)
+		assert.Equal(t, Pivot{X: 0.5, Y: 0.5}, in.Pivot())
+		in.SetPivotPixels(9.5, 25.5)
+		require.NoError(t, p.Pack())
+
+		f := p.Result().Frames[0]
+		assert.Equal(t, rotate != RNever, f.Rotated)
+		assert.Equal(t, Pivot{X: 9.5 / 20, Y: 25.5 / 30}, f.Pivot)
+		assert.Equal(t, Pivot{X: 5.5, Y: 19.5}, f.ContentPivot)
+
+		x, y := int(math.Floor(f.AtlasPivot.X)), int(math.Floor(f.AtlasPivot.Y))
+		assert.Equal(t, color.RGBA{R: 255, A: 255}, p.OutputImages[0].Image.At(x, y))
+	}
+}
+
+// TestNineSlice tests the nine-slice borders
+func TestNineSlice(t *testing.T) {
+	black := color.NRGBA{A: 255}
+	img := image.NewNRGBA(image.Rect(0, 0, 12, 12))
+	draw.Draw(img, image.Rect(6, 2, 11, 10), &image.Uniform{color.NRGBA{B: 255, A: 255}}, image.ZP, draw.Src)
+	for x := 4; x <= 7; x++ {
+		img.SetNRGBA(x, 0, black)
+	}
+	for y := 3; y <= 8; y++ {
+		img.SetNRGBA(0, y, black)
+	}
+	for x := 2; x <= 9; x++ {
+		img.SetNRGBA(x, 11, black)
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	patch := append([]byte(nil), buf.Bytes()...)
+
+	p := New(nil)
+	images, err := p.AddFS(fstest.MapFS{"ui/button.9.png": {Data: patch}})
+	require.NoError(t, err)
+	require.Len(t, images, 1)
+	in := images[0]
+	assert.Equal(t, "ui/button", in.Name)
+	assert.Equal(t, image.Rect(0, 0, 10, 10), in.Bounds())
+	assert.Equal(t, &NineSlice{
+		Split: Insets{Left: 3, Top: 2, Right: 3, Bottom: 2},
+		Pad:   &Insets{Left: 1, Top: 2, Right: 1, Bottom: 2},
+	}, in.NineSlice())
+
+	require.NoError(t, p.Pack())
+	// the trimming stops at the stretched center
+	assert.Equal(t, Trim{Left: 3, Top: 1, Right: 0, Bottom: 1}, in.Trim())
+
+	buf.Reset()
+	require.NoError(t, p.WriteLibGDX(&buf, "atlas.png"))
+	assert.Contains(t, buf.String(), "ui/button\n  rotate: false\n")
+	assert.Contains(t, buf.String(), "  split: 0, 3, 1, 1\n  pad: 0, 1, 1, 1\n")
+	assert.Contains(t, buf.String(), "  orig: 10, 10\n  offset: 3, 1\n  pivot: 5, 5\n  index: -1\n")
+
+	buf.Reset()
+	require.NoError(t, p.WriteJSON(&buf, 0, "atlas.png"))
+	assert.Contains(t, buf.String(), `"scale9Borders": {
+        "x": 3,
+        "y": 2,
+        "w": 4,
+        "h": 6
+      }`)
+
+	assert.Equal(t, ErrInvalidPage, p.WriteLibGDX(&buf))
+
+	cfg := DefaultConfig()
+	cfg.KeepExtension = true
+	images, err = New(cfg).AddFS(fstest.MapFS{"ui/button.9.png": {Data: patch}})
+	require.NoError(t, err)
+	require.Len(t, images, 1)
+	assert.Equal(t, "ui/button.png", images[0].Name)
+	assert.NotNil(t, images[0].NineSlice())
+
+	_, err = p.AddNinePatch(image.NewNRGBA(image.Rect(0, 0, 4, 4)))
+	assert.Equal(t, ErrInvalidNinePatch, err)
+}
+
+// TestMesh tests the polygon meshes
+func TestMesh(t *testing.T) {
+	// the L shape taller than wide and the disc
+	shapes := []*image.NRGBA{image.NewNRGBA(image.Rect(0, 0, 30, 50)), image.NewNRGBA(image.Rect(0, 0, 48, 48))}
+	draw.Draw(shapes[0], image.Rect(2, 2, 10, 48), &image.Uniform{color.NRGBA{R: 255, A: 255}}, image.ZP, draw.Src)
+	draw.Draw(shapes[0], image.Rect(2, 40, 28, 48), &image.Uniform{color.NRGBA{R: 255, A: 255}}, image.ZP, draw.Src)
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 48; x++ {
+			if dx, dy := float64(x)-23.5, float64(y)-23.5; dx*dx+dy*dy < 20*20 {
+				shapes[1].SetNRGBA(x, y, color.NRGBA{G: 255, A: 255})
+			}
+		}
+	}
+
+	inside := func(m *Mesh, x, y float64) bool {
+		for _, tr := range m.Triangles {
+			a, b, c := m.AtlasVertices[tr[0]], m.AtlasVertices[tr[1]], m.AtlasVertices[tr[2]]
+			d1 := (b.X-a.X)*(y-a.Y) - (b.Y-a.Y)*(x-a.X)
+			d2 := (c.X-b.X)*(y-b.Y) - (c.Y-b.Y)*(x-b.X)
+			d3 := (a.X-c.X)*(y-c.Y) - (a.Y-c.Y)*(x-c.X)
+			if (d1 >= 0 && d2 >= 0 && d3 >= 0) || (d1 <= 0 && d2 <= 0 && d3 <= 0) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, mode := range []MeshMode{MeshConvex, MeshConcave} {
+		cfg := DefaultConfig()
+		cfg.Mesh = mode
+		cfg.MeshVertices = 6
+		cfg.Rotation = RHeightGreaterWidth
+		p := New(cfg)
+		for _, shape := range shapes {
+			_, err := p.AddImage(shape)
+			require.NoError(t, err)
+		}
+		require.NoError(t, p.Pack())
+
+		for _, f := range p.Result().Frames {
+			m := f.Mesh
+			require.NotNil(t, m)
+			assert.True(t, len(m.Vertices) <= 6)
+			assert.Len(t, m.Triangles, len(m.Vertices)-2)
+
+			var area float64
+			for _, tr := range m.Triangles {
+				a, b, c := m.AtlasVertices[tr[0]], m.AtlasVertices[tr[1]], m.AtlasVertices[tr[2]]
+				area += math.Abs((b.X-a.X)*(c.Y-a.Y)-(b.Y-a.Y)*(c.X-a.X)) / 2
+			}
+			assert.True(t, area < float64(f.Rect.Dx()*f.Rect.Dy()), "the mesh cuts the overdraw")
+
+			for y := f.Rect.Min.Y; y < f.Rect.Max.Y; y++ {
+				for x := f.Rect.Min.X; x < f.Rect.Max.X; x++ {
+					if _, _, _, a := p.OutputImages[0].Image.At(x, y).RGBA(); a != 0 {
+						require.True(t, inside(m, float64(x)+0.5, float64(y)+0.5), "pixel %d,%d is outside", x, y)
+					}
+				}
+			}
+			for i, uv := range m.UVs {
+				assert.InDelta(t, m.AtlasVertices[i].X/float64(p.OutputImages[0].Image.Bounds().Dx()), uv.X, 1e-9)
+			}
+		}
+	}
+}
+
+// TestMaskPacking tests the mask packing
+func TestMaskPacking(t *testing.T) {
+	// the triangles of the two orientations interlock to the squares
+	triangle := func(i int) *image.NRGBA {
+		img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+		for y := 0; y < 32; y++ {
+			for x := 0; x < 32; x++ {
+				if (x <= y) == (i%2 == 0) {
+					img.SetNRGBA(x, y, color.NRGBA{R: uint8(i), G: uint8(x), B: uint8(y), A: 255})
+				}
+			}
+		}
+		return img
+	}
+
+	pack := func(mode PackingMode, gap int) *Packer {
+		cfg := DefaultConfig()
+		cfg.TextureWidth, cfg.TextureHeight = 128, 128
+		cfg.Packing = mode
+		cfg.MaskGap = gap
+		p := New(cfg)
+		for i := 0; i < 32; i++ {
+			in, err := p.AddImage(triangle(i))
+			require.NoError(t, err)
+			in.Name = fmt.Sprintf("triangle_%02d", i)
+		}
+		require.NoError(t, p.Pack())
+		return p
+	}
+
+	assert.Len(t, pack(PackRects, 0).OutputImages, 2)
+
+	for _, gap := range []int{0, 1} {
+		p := pack(PackMasks, gap)
+		if gap == 0 {
+			assert.Len(t, p.OutputImages, 1)
+		}
+
+		owner := map[image.Point]int{}
+		for _, f := range p.Result().Frames {
+			src := f.Image.Image()
+			for y := 0; y < 32; y++ {
+				for x := 0; x < 32; x++ {
+					c := color.NRGBAModel.Convert(src.At(x, y)).(color.NRGBA)
+					if c.A == 0 {
+						continue
+					}
+					at := image.Pt(x, y).Add(f.Rect.Min).Sub(image.Pt(f.Trim.Left, f.Trim.Top))
+					require.Equal(t, c, color.NRGBAModel.Convert(p.OutputImages[f.TextureID].Image.At(at.X, at.Y)))
+
+					at.X += 1000 * f.TextureID
+					for dy := -gap; dy <= gap; dy++ {
+						for dx := -gap; dx <= gap; dx++ {
+							if o, ok := owner[at.Add(image.Pt(dx, dy))]; ok {
+								require.Equal(t, f.Image.id, o, "the images are closer than the gap")
+							}
+						}
+					}
+					owner[at] = f.Image.id
+				}
+			}
+		}
+	}
+}
+
+// TestRotation tests the rotation modes
+func TestRotation(t *testing.T) {
+	strip := func(i, w, h int) *image.NRGBA {
+		img := image.NewNRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				img.SetNRGBA(x, y, color.NRGBA{R: uint8(i), G: uint8(x), B: uint8(y), A: 255})
+			}
+		}
+		return img
+	}
+
+	pages := map[Rotation]int{}
+	for _, rotate := range []Rotation{ROnlyWhenNeeded, RBestFit} {
+		for _, dir := range []RotationDirection{RotateCCW, RotateCW} {
+			cfg := DefaultConfig()
+			cfg.TextureWidth, cfg.TextureHeight = 64, 64
+			cfg.Heuristic = HBssf
+			cfg.Rotation = rotate
+			cfg.RotationDirection = dir
+			p := New(cfg)
+			for i := 0; i < 12; i++ {
+				w, h := 8, 24+i
+				if i%2 == 0 {
+					w, h = h, w
+				}
+				in, err := p.AddImage(strip(i, w, h))
+				require.NoError(t, err)
+				in.Name = fmt.Sprintf("strip_%02d", i)
+			}
+			require.NoError(t, p.Pack())
+			pages[rotate] = len(p.OutputImages)
+
+			rotated := false
+			for _, f := range p.Result().Frames {
+				rotated = rotated || f.Rotated
+				assert.Equal(t, dir, f.Direction)
+
+				src := f.Image.Image()
+				b := src.Bounds()
+				for y := 0; y < b.Dy(); y++ {
+					for x := 0; x < b.Dx(); x++ {
+						ax, ay := f.atlasPoint(float64(x)+0.5, float64(y)+0.5)
+						at := p.OutputImages[f.TextureID].Image.At(int(math.Floor(ax)), int(math.Floor(ay)))
+						require.Equal(t, color.NRGBAModel.Convert(src.At(x, y)), color.NRGBAModel.Convert(at), f.Image.Name)
+					}
+				}
+			}
+			require.True(t, rotated)
+
+			// the formats read only one of the directions
+			var buf bytes.Buffer
+			for _, page := range p.OutputImages {
+				pageRotated := false
+				for _, f := range p.Result().Frames {
+					pageRotated = pageRotated || f.TextureID == page.ID && f.Rotated
+				}
+				err := p.WriteJSON(&buf, page.ID, "atlas.png")
+				if pageRotated && dir == RotateCCW {
+					assert.Equal(t, ErrRotationDirection, err)
+				} else {
+					require.NoError(t, err)
+					assert.Contains(t, buf.String(), fmt.Sprintf(`"rotation": "%s"`, dir))
+				}
+			}
+
+			buf.Reset()
+			names := make([]string, len(p.OutputImages))
+			err := p.WriteLibGDX(&buf, names...)
+			if dir == RotateCW {
+				assert.Equal(t, ErrRotationDirection, err)
+			} else {
+				require.NoError(t, err)
+				assert.Contains(t, buf.String(), "rotate: true\n")
+			}
+		}
+	}
+	assert.LessOrEqual(t, pages[RBestFit], pages[ROnlyWhenNeeded])
+}
+
+// TestDedupTransforms tests the transformed duplicate merging
+func TestDedupTransforms(t *testing.T) {
+	sprite := image.NewNRGBA(image.Rect(0, 0, 14, 22))
+	for y := 2; y < 19; y++ {
+		for x := 1; x < 11; x++ {
+			sprite.SetNRGBA(x, y, color.NRGBA{R: uint8(10 * x), G: uint8(10 * y), B: 128, A: 255})
+		}
+	}
+
+	all := []Transform{TransformNone}
+	all = append(all, transforms...)
+
+	for _, enabled := range []bool{false, true} {
+		for _, dir := range []RotationDirection{RotateCCW, RotateCW} {
+			cfg := DefaultConfig()
+			cfg.DedupTransforms = enabled
+			cfg.Scales = []float64{0.5}
+			cfg.Rotation = RHeightGreaterWidth
+			cfg.RotationDirection = dir
+			p := New(cfg)
+			for _, tr := range all {
+				in, err := p.AddImage(tr.apply(sprite))
+				require.NoError(t, err)
+				in.Name = "sprite_" + tr.String()
+			}
+			require.NoError(t, p.Pack())
+
+			if !enabled {
+				assert.Empty(t, p.Result().Merged)
+				continue
+			}
+			require.Len(t, p.Result().Merged, len(transforms))
+			for _, f := range p.Result().Variants[0].Frames {
+				size := f.Rect.Size()
+				if f.Rotated != f.Transform.swapsAxes() {
+					size = image.Pt(size.Y, size.X)
+				}
+				trim := image.Pt(f.Trim.Left+f.Trim.Right, f.Trim.Top+f.Trim.Bottom)
+				assert.Equal(t, f.SourceSize, size.Add(trim), f.Image.Name)
+			}
+			for _, m := range p.Result().Merged {
+				assert.Equal(t, "sprite_flipH", m.Into.Name)
+				assert.True(t, samePixels(m.Transform.apply(m.Into.Image()), m.Image.Image()), m.Image.Name)
+			}
+
+			for _, f := range p.Result().Frames {
+				src := f.Image.Image()
+				crop := image.Rect(f.Trim.Left, f.Trim.Top, f.SourceSize.X-f.Trim.Right, f.SourceSize.Y-f.Trim.Bottom)
+				assert.Equal(t, 10*17, crop.Dx()*crop.Dy(), f.Image.Name)
+				for y := 0; y < crop.Dy(); y++ {
+					for x := 0; x < crop.Dx(); x++ {
+						ax, ay := f.atlasPoint(float64(x)+0.5, float64(y)+0.5)
+						at := p.OutputImages[f.TextureID].Image.At(int(math.Floor(ax)), int(math.Floor(ay)))
+						require.Equal(t, color.NRGBAModel.Convert(src.At(crop.Min.X+x, crop.Min.Y+y)), color.NRGBAModel.Convert(at), f.Image.Name)
+					}
+				}
+			}
+
+			var buf bytes.Buffer
+			if dir == RotateCCW {
+				assert.Equal(t, ErrRotationDirection, p.WriteJSON(&buf, 0, "atlas.png"))
+				continue
+			}
+			require.NoError(t, p.WriteJSON(&buf, 0, "atlas.png"))
+			assert.Contains(t, buf.String(), `"transform": "flipH"`)
+			assert.Contains(t, buf.String(), `"transform": "rotate90"`)
+		}
+	}
+}
+
+// TestTileMap tests the tile maps
+func TestTileMap(t *testing.T) {
+	tile := func(i int) *image.Uniform {
+		return &image.Uniform{color.NRGBA{R: uint8(60 * i), G: uint8(255 - 60*i), B: 40, A: 255}}
+	}
+	level := func(w, h, columns int, pattern []int) *image.NRGBA {
+		img := image.NewNRGBA(image.Rect(0, 0, w, h))
+		for i, k := range pattern {
+			if k < 0 {
+				continue
+			}
+			x, y := 16*(i%columns), 16*(i/columns)
+			draw.Draw(img, image.Rect(x, y, x+16, y+16), tile(k), image.ZP, draw.Src)
+		}
+		// the details crossing the tiles
+		img.SetNRGBA(15, 15, color.NRGBA{R: 255, A: 255})
+		img.SetNRGBA(16, 16, color.NRGBA{B: 255, A: 255})
+		return img
+	}
+
+	levels := []*image.NRGBA{
+		level(70, 48, 5, []int{0, 1, 0, 1, 2, 1, 0, 1, 0, 2, -1, 3, 3, 3, 2}),
+		level(64, 32, 4, []int{0, 1, 0, 1, 2, 2, 2, 3}),
+	}
+
+	// the tiles are not grouped into the animations
+	cfg := DefaultConfig()
+	cfg.SequencePattern = DefaultSequencePattern
+	p := New(cfg)
+	_, err := p.AddTileMap(levels[0], "level", 0, 16)
+	assert.Equal(t, ErrInvalidTile, err)
+
+	var maps []*TileMap
+	for i, img := range levels {
+		m, err := p.AddTileMap(img, fmt.Sprintf("level%d", i), 16, 16)
+		require.NoError(t, err)
+		maps = append(maps, m)
+	}
+	assert.Equal(t, 5, maps[0].Columns)
+	assert.Equal(t, 3, maps[0].Rows)
+	assert.Nil(t, maps[0].Tiles[10])
+	// the four plain tiles, the three with the details and the edge column
+	assert.Len(t, p.images.inputImages, 8)
+	assert.Same(t, maps[0].Tiles[2], maps[1].Tiles[2])
+
+	require.NoError(t, p.Pack())
+	assert.Empty(t, p.Result().Animations)
+	require.Len(t, p.Result().TileMaps, 2)
+
+	for i, m := range p.Result().TileMaps {
+		b := levels[i].Bounds()
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				want := color.NRGBAModel.Convert(levels[i].At(x, y))
+				f := m.Frames[(y/16)*m.Columns+x/16]
+				if f == nil {
+					require.Equal(t, color.NRGBA{}, want)
+					continue
+				}
+				at := f.Rect.Min.Add(image.Pt(x%16, y%16))
+				require.Equal(t, want, color.NRGBAModel.Convert(p.OutputImages[f.TextureID].Image.At(at.X, at.Y)))
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, p.WriteTileMap(&buf, p.Result().TileMaps[1]))
+	var out struct {
+		Columns int      `json:"columns"`
+		Tiles   []string `json:"tiles"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+	assert.Equal(t, 4, out.Columns)
+	assert.Equal(t, "level0_002", out.Tiles[2])
+
+	// the empty tiles do not depend on the Crop
+	cfg = DefaultConfig()
+	cfg.Crop = false
+	m, err := New(cfg).AddTileMap(levels[0], "level", 16, 16)
+	require.NoError(t, err)
+	assert.Nil(t, m.Tiles[10])
+	assert.NotNil(t, m.Tiles[14])
+}
+
+// TestQuantize tests the page quantization
+func TestQuantize(t *testing.T) {
+	gradient := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+	for y := 2; y < 38; y++ {
+		for x := 2; x < 38; x++ {
+			gradient.SetNRGBA(x, y, color.NRGBA{R: uint8(7 * x), G: uint8(7 * y), B: 90, A: 255})
+		}
+	}
+	glow := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for x := 0; x < 16; x++ {
+		draw.Draw(glow, image.Rect(x, 0, x+1, 16), &image.Uniform{color.NRGBA{R: 255, G: 220, A: uint8(16*x + 15)}}, image.ZP, draw.Src)
+	}
+	flat := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	draw.Draw(flat, image.Rect(0, 0, 8, 4), &image.Uniform{color.NRGBA{B: 255, A: 255}}, image.ZP, draw.Src)
+
+	pack := func(cfg *Config) *Packer {
+		p := New(cfg)
+		for i, img := range []image.Image{gradient, glow, flat} {
+			in, err := p.AddImage(img)
+			require.NoError(t, err)
+			in.Name = fmt.Sprintf("sprite_%c", 'a'+i)
+		}
+		require.NoError(t, p.Pack())
+		return p
+	}
+
+	reference := pack(DefaultConfig())
+	var buf bytes.Buffer
+	assert.Equal(t, ErrNoPalette, reference.WritePalette(&buf, 0))
+
+	for _, mode := range []QuantizeMode{QuantizeMedianCut, QuantizeOctree} {
+		for _, dither := range []bool{false, true} {
+			cfg := DefaultConfig()
+			cfg.Quantize = mode
+			cfg.PaletteSize = 16
+			cfg.Dither = dither
+			p := pack(cfg)
+
+			want := reference.OutputImages[0].Image
+			got, ok := p.OutputImages[0].Image.(*image.Paletted)
+			require.True(t, ok)
+			assert.LessOrEqual(t, len(got.Palette), 16)
+			assert.Equal(t, color.NRGBA{}, got.Palette[0])
+
+			var sum, n int
+			b := want.Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					w := color.NRGBAModel.Convert(want.At(x, y)).(color.NRGBA)
+					g := color.NRGBAModel.Convert(got.At(x, y)).(color.NRGBA)
+					if w.A == 0 {
+						require.Equal(t, color.NRGBA{}, g)
+						continue
+					}
+					require.NotZero(t, g.A)
+					sum += int(diff(w.R, g.R)) + int(diff(w.G, g.G)) + int(diff(w.B, g.B)) + int(diff(w.A, g.A))
+					n += 4
+				}
+			}
+			assert.Less(t, sum/n, 24, "mode %d dither %t", mode, dither)
+		}
+	}
+
+	// the pages of the variants share the palette
+	cfg := DefaultConfig()
+	cfg.Quantize = QuantizeMedianCut
+	cfg.PaletteSize = 8
+	cfg.SharedPalette = true
+	cfg.Scales = []float64{0.5}
+	p := pack(cfg)
+	palette := p.OutputImages[0].Image.(*image.Paletted).Palette
+	assert.Equal(t, palette, p.Result().Variants[0].OutputImages[0].Image.(*image.Paletted).Palette)
+
+	buf.Reset()
+	require.NoError(t, p.WritePalette(&buf, 0))
+	var colors []string
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &colors))
+	assert.Len(t, colors, len(palette))
+	assert.Equal(t, "#00000000", colors[0])
+
+	var variantColors []string
+	buf.Reset()
+	require.NoError(t, p.WriteVariantPalette(&buf, p.Result().Variants[0], 0))
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &variantColors))
+	assert.Equal(t, colors, variantColors)
+	assert.Equal(t, ErrInvalidPage, p.WriteVariantPalette(&buf, p.Result().Variants[0], 1))
+
+	// the palette size is checked before the packing
+	cfg.PaletteSize = 300
+	p = New(cfg)
+	_, err := p.AddImage(flat)
+	require.NoError(t, err)
+	assert.Equal(t, ErrInvalidPalette, p.Pack())
+	assert.Empty(t, p.OutputImages)
+}
+
 // BenchmarkPacker banches the packer
 func BenchmarkPacker(b *testing.B) {
 
@@ -319,3 +1915,66 @@ func BenchmarkPacker(b *testing.B) {
 		})
 	})
 }
+
+// BenchmarkInput benches the input pixel buffers
+func BenchmarkInput(b *testing.B) {
+	bounds := image.Rect(0, 0, 1024, 1024)
+	content := image.Rect(100, 200, 900, 800)
+	fill := &image.Uniform{color.NRGBA{R: 200, G: 100, B: 50, A: 128}}
+
+	nrgba := image.NewNRGBA(bounds)
+	draw.Draw(nrgba, content, fill, image.ZP, draw.Src)
+
+	rgba := image.NewRGBA(bounds)
+	draw.Draw(rgba, content, fill, image.ZP, draw.Src)
+
+	paletted := image.NewPaletted(bounds, color.Palette{color.Transparent, fill.C})
+	draw.Draw(paletted, content, fill, image.ZP, draw.Src)
+
+	gray := image.NewGray16(bounds)
+	draw.Draw(gray, content, fill, image.ZP, draw.Src)
+
+	inputs := []struct {
+		name string
+		img  image.Image
+	}{
+		{"NRGBA", nrgba},
+		{"RGBA", rgba},
+		{"Paletted", paletted},
+		{"Generic", gray},
+	}
+
+	b.Run("AddImage", func(b *testing.B) {
+		for _, in := range inputs {
+			b.Run(in.name, func(b *testing.B) {
+				p := New(DefaultConfig())
+				for i := 0; i < b.N; i++ {
+					_, err := p.AddImage(in.img)
+					require.NoError(b, err)
+				}
+			})
+		}
+	})
+
+	b.Run("crop", func(b *testing.B) {
+		for _, in := range inputs {
+			b.Run(in.name, func(b *testing.B) {
+				p := New(DefaultConfig())
+				for i := 0; i < b.N; i++ {
+					p.crop(in.img)
+				}
+			})
+		}
+	})
+
+	b.Run("hashPixels", func(b *testing.B) {
+		for _, in := range inputs {
+			b.Run(in.name, func(b *testing.B) {
+				p := New(DefaultConfig())
+				for i := 0; i < b.N; i++ {
+					p.hashPixels(in.img)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,418 @@
+package packer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+)
+
+// ErrInvalidPalette is an error thrown when the palette size is not 2-256
+var ErrInvalidPalette = errors.New("Invalid palette size provided")
+
+// ErrNoPalette is an error thrown when the page is not quantized
+var ErrNoPalette = errors.New("The page has no palette")
+
+// colorCount is the histogram color
+type colorCount struct {
+	c color.NRGBA
+	n int
+}
+
+// quantizeImages quantizes the pages
+func (p *Packer) quantizeImages(pages []*OutputImage) error {
+	if p.cfg.Quantize == QuantizeNone || len(pages) == 0 {
+		return nil
+	}
+
+	if p.cfg.SharedPalette {
+		hist := map[color.NRGBA]int{}
+		for _, page := range pages {
+			histogram(hist, page.Image)
+		}
+		palette := p.palette(hist)
+		for _, page := range pages {
+			page.Image = p.paletted(page.Image, palette)
+		}
+		return nil
+	}
+
+	for _, page := range pages {
+		hist := map[color.NRGBA]int{}
+		histogram(hist, page.Image)
+		page.Image = p.paletted(page.Image, p.palette(hist))
+
+		select {
+		case <-p.ctx.Done():
+			return p.ctx.Err()
+		default:
+		}
+	}
+	return nil
+}
+
+// histogram counts the image colors
+func histogram(hist map[color.NRGBA]int, img image.Image) {
+	b := img.Bounds()
+	rows := newRowReader(img)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := rows.row(y)
+		for x := 0; x < len(row); x += 4 {
+			c := color.NRGBA{R: row[x], G: row[x+1], B: row[x+2], A: row[x+3]}
+			if c.A == 0 {
+				c = color.NRGBA{}
+			}
+			hist[c]++
+		}
+	}
+}
+
+// palette reduces the histogram, the transparent color is first
+func (p *Packer) palette(hist map[color.NRGBA]int) color.Palette {
+	var palette color.Palette
+	n := p.cfg.PaletteSize
+	if _, ok := hist[color.NRGBA{}]; ok {
+		palette = append(palette, color.NRGBA{})
+		n--
+	}
+
+	var colors []colorCount
+	for c, count := range hist {
+		if c.A != 0 {
+			colors = append(colors, colorCount{c, count})
+		}
+	}
+	// the map order is random, the colors are sorted so the palette is
+	// the same for the same images
+	sort.Slice(colors, func(i, j int) bool {
+		a, b := colors[i].c, colors[j].c
+		return uint32(a.R)<<24|uint32(a.G)<<16|uint32(a.B)<<8|uint32(a.A) <
+			uint32(b.R)<<24|uint32(b.G)<<16|uint32(b.B)<<8|uint32(b.A)
+	})
+
+	var reduced []color.NRGBA
+	switch {
+	case len(colors) <= n:
+		for _, c := range colors {
+			reduced = append(reduced, c.c)
+		}
+	case p.cfg.Quantize == QuantizeOctree:
+		reduced = octree(colors, n)
+	default:
+		reduced = medianCut(colors, n)
+	}
+
+	for _, c := range reduced {
+		palette = append(palette, c)
+	}
+	return palette
+}
+
+// medianCut reduces the colors by the median cut
+func medianCut(colors []colorCount, n int) []color.NRGBA {
+	type box struct {
+		colors  []colorCount
+		channel int
+		width   int
+	}
+
+	channel := func(c color.NRGBA, k int) int {
+		return int([4]uint8{c.R, c.G, c.B, c.A}[k])
+	}
+	newBox := func(colors []colorCount) *box {
+		b := &box{colors: colors}
+		for k := 0; k < 4; k++ {
+			lo, hi := 255, 0
+			for _, c := range colors {
+				lo, hi = min(lo, channel(c.c, k)), max(hi, channel(c.c, k))
+			}
+			if hi-lo > b.width {
+				b.channel, b.width = k, hi-lo
+			}
+		}
+		return b
+	}
+
+	boxes := []*box{newBox(colors)}
+	for len(boxes) < n {
+		// the box with the widest channel is split
+		split := -1
+		for i, b := range boxes {
+			if len(b.colors) < 2 {
+				continue
+			}
+			if split < 0 || b.width > boxes[split].width {
+				split = i
+			}
+		}
+		if split < 0 {
+			break
+		}
+
+		b := boxes[split]
+		sort.SliceStable(b.colors, func(i, j int) bool {
+			return channel(b.colors[i].c, b.channel) < channel(b.colors[j].c, b.channel)
+		})
+
+		var total, half int
+		for _, c := range b.colors {
+			total += c.n
+		}
+		at := 1
+		for i, c := range b.colors[:len(b.colors)-1] {
+			half += c.n
+			at = i + 1
+			if 2*half >= total {
+				break
+			}
+		}
+
+		boxes[split] = newBox(b.colors[:at])
+		boxes = append(boxes, newBox(b.colors[at:]))
+	}
+
+	var palette []color.NRGBA
+	for _, b := range boxes {
+		palette = append(palette, average(b.colors))
+	}
+	return palette
+}
+
+// octreeNode is the color octree node
+type octreeNode struct {
+	children [16]*octreeNode
+	colors   []colorCount
+	leaf     bool
+	count    int
+}
+
+// octree reduces the colors by the octree
+func octree(colors []colorCount, n int) []color.NRGBA {
+	root := &octreeNode{}
+	levels := make([][]*octreeNode, 8)
+	leaves := 0
+
+	for _, c := range colors {
+		node := root
+		for level := 0; level < 8; level++ {
+			node.count += c.n
+			shift := uint(7 - level)
+			i := (c.c.R>>shift&1)<<3 | (c.c.G>>shift&1)<<2 | (c.c.B>>shift&1)<<1 | c.c.A>>shift&1
+			child := node.children[i]
+			if child == nil {
+				child = &octreeNode{}
+				node.children[i] = child
+				if level < 7 {
+					levels[level+1] = append(levels[level+1], child)
+				} else {
+					child.leaf = true
+					leaves++
+				}
+			}
+			node = child
+		}
+		node.count += c.n
+		node.colors = append(node.colors, c)
+	}
+
+	for level := 7; level >= 0 && leaves > n; level-- {
+		nodes := levels[level]
+		if level == 0 {
+			nodes = []*octreeNode{root}
+		}
+		sort.SliceStable(nodes, func(i, j int) bool {
+			return nodes[i].count < nodes[j].count
+		})
+
+		for _, node := range nodes {
+			if leaves <= n {
+				break
+			}
+			merged := 0
+			for i, child := range node.children {
+				if child == nil {
+					continue
+				}
+				node.colors = append(node.colors, child.colors...)
+				node.children[i] = nil
+				merged++
+			}
+			node.leaf = true
+			leaves -= merged - 1
+		}
+	}
+
+	var palette []color.NRGBA
+	var walk func(node *octreeNode)
+	walk = func(node *octreeNode) {
+		if node.leaf {
+			palette = append(palette, average(node.colors))
+			return
+		}
+		for _, child := range node.children {
+			if child != nil {
+				walk(child)
+			}
+		}
+	}
+	walk(root)
+
+	return palette
+}
+
+// average computes the alpha weighted average
+func average(colors []colorCount) color.NRGBA {
+	var r, g, b, a, total float64
+	for _, c := range colors {
+		n, alpha := float64(c.n), float64(c.c.A)
+		r += float64(c.c.R) * alpha * n
+		g += float64(c.c.G) * alpha * n
+		b += float64(c.c.B) * alpha * n
+		a += alpha * n
+		total += n
+	}
+	if a == 0 {
+		return color.NRGBA{}
+	}
+	return color.NRGBA{
+		R: uint8(r/a + 0.5),
+		G: uint8(g/a + 0.5),
+		B: uint8(b/a + 0.5),
+		A: uint8(a/total + 0.5),
+	}
+}
+
+// paletted converts the image to the palette
+func (p *Packer) paletted(img image.Image, palette color.Palette) *image.Paletted {
+	b := img.Bounds()
+	dst := image.NewPaletted(b, palette)
+	rows := newRowReader(img)
+
+	colors := make([][4]float64, len(palette))
+	transparent := -1
+	for i, c := range palette {
+		n := c.(color.NRGBA)
+		colors[i] = premultiplied(n.R, n.G, n.B, n.A)
+		if n.A == 0 && transparent < 0 {
+			transparent = i
+		}
+	}
+
+	cache := map[[4]float64]uint8{}
+	nearest := func(c [4]float64) uint8 {
+		if i, ok := cache[c]; ok {
+			return i
+		}
+		best, dist := 0, -1.0
+		for i, pc := range colors {
+			if i == transparent {
+				continue
+			}
+			var d float64
+			for k := range pc {
+				d += (pc[k] - c[k]) * (pc[k] - c[k])
+			}
+			if dist < 0 || d < dist {
+				best, dist = i, d
+			}
+		}
+		cache[c] = uint8(best)
+		return uint8(best)
+	}
+
+	// the errors of the current and the next row in the premultiplied values
+	w := b.Dx()
+	errs := [2][][4]float64{make([][4]float64, w+2), make([][4]float64, w+2)}
+
+	for y := 0; y < b.Dy(); y++ {
+		row := rows.row(b.Min.Y + y)
+		cur, next := errs[0], errs[1]
+		for x := range next {
+			next[x] = [4]float64{}
+		}
+
+		for x := 0; x < w; x++ {
+			px := row[4*x : 4*x+4]
+			if px[3] == 0 && transparent >= 0 {
+				dst.Pix[y*dst.Stride+x] = uint8(transparent)
+				continue
+			}
+
+			c := premultiplied(px[0], px[1], px[2], px[3])
+			if p.cfg.Dither {
+				// the premultiplied channels stay within the alpha, the
+				// values are rounded so the nearest colors are cached
+				e := cur[x+1]
+				c[3] = math.Round(clamp(c[3]+e[3], 0, 255))
+				for k := 0; k < 3; k++ {
+					c[k] = math.Round(clamp(c[k]+e[k], 0, c[3]))
+				}
+			}
+
+			i := nearest(c)
+			dst.Pix[y*dst.Stride+x] = i
+			if !p.cfg.Dither {
+				continue
+			}
+
+			for k := range c {
+				e := c[k] - colors[i][k]
+				cur[x+2][k] += e * 7 / 16
+				next[x][k] += e * 3 / 16
+				next[x+1][k] += e * 5 / 16
+				next[x+2][k] += e / 16
+			}
+		}
+
+		errs[0], errs[1] = next, cur
+	}
+
+	return dst
+}
+
+// premultiplied premultiplies the color
+func premultiplied(r, g, b, a uint8) [4]float64 {
+	alpha := float64(a) / 255
+	return [4]float64{float64(r) * alpha, float64(g) * alpha, float64(b) * alpha, float64(a)}
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Min(math.Max(v, lo), hi)
+}
+
+// WritePalette writes the page palette as the #rrggbbaa JSON array
+func (p *Packer) WritePalette(w io.Writer, textureID int) error {
+	if p.result == nil || textureID < 0 || textureID >= len(p.OutputImages) {
+		return ErrInvalidPage
+	}
+	return writePalette(w, p.OutputImages[textureID])
+}
+
+// WriteVariantPalette writes the variant page palette
+func (p *Packer) WriteVariantPalette(w io.Writer, v *Variant, textureID int) error {
+	if p.result == nil || textureID < 0 || textureID >= len(v.OutputImages) {
+		return ErrInvalidPage
+	}
+	return writePalette(w, v.OutputImages[textureID])
+}
+
+func writePalette(w io.Writer, page *OutputImage) error {
+	img, ok := page.Image.(*image.Paletted)
+	if !ok {
+		return ErrNoPalette
+	}
+
+	colors := make([]string, len(img.Palette))
+	for i, c := range img.Palette {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		colors[i] = fmt.Sprintf("#%02x%02x%02x%02x", n.R, n.G, n.B, n.A)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(colors)
+}
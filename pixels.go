@@ -0,0 +1,137 @@
+package packer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc64"
+	"image"
+	"image/color"
+)
+
+// rowReader reads the image rows as the NRGBA bytes
+type rowReader struct {
+	img image.Image
+	b   image.Rectangle
+	buf []byte
+
+	// palette holds the converted palette of the *image.Paletted
+	palette [][4]uint8
+}
+
+func newRowReader(img image.Image) *rowReader {
+	r := &rowReader{img: img, b: img.Bounds()}
+
+	switch i := img.(type) {
+	case *image.NRGBA:
+		return r
+	case *image.Paletted:
+		r.palette = make([][4]uint8, len(i.Palette))
+		for k, c := range i.Palette {
+			n := color.NRGBAModel.Convert(c).(color.NRGBA)
+			r.palette[k] = [4]uint8{n.R, n.G, n.B, n.A}
+		}
+	}
+	r.buf = make([]byte, 4*r.b.Dx())
+
+	return r
+}
+
+// row returns the row y, valid until the next call
+func (r *rowReader) row(y int) []byte {
+	w := r.b.Dx()
+
+	switch i := r.img.(type) {
+	case *image.NRGBA:
+		off := i.PixOffset(r.b.Min.X, y)
+		return i.Pix[off : off+4*w]
+	case *image.RGBA:
+		off := i.PixOffset(r.b.Min.X, y)
+		src := i.Pix[off : off+4*w]
+		for x := 0; x < 4*w; x += 4 {
+			a := src[x+3]
+			switch a {
+			case 0xff:
+				copy(r.buf[x:x+4], src[x:x+4])
+			case 0:
+				r.buf[x], r.buf[x+1], r.buf[x+2], r.buf[x+3] = 0, 0, 0, 0
+			default:
+				// the same rounding as the color.NRGBAModel
+				a16 := uint32(a) * 0x101
+				r.buf[x] = uint8(uint32(src[x]) * 0x101 * 0xffff / a16 >> 8)
+				r.buf[x+1] = uint8(uint32(src[x+1]) * 0x101 * 0xffff / a16 >> 8)
+				r.buf[x+2] = uint8(uint32(src[x+2]) * 0x101 * 0xffff / a16 >> 8)
+				r.buf[x+3] = a
+			}
+		}
+	case *image.Paletted:
+		off := i.PixOffset(r.b.Min.X, y)
+		for x, idx := range i.Pix[off : off+w] {
+			var c [4]uint8
+			if int(idx) < len(r.palette) {
+				c = r.palette[idx]
+			}
+			copy(r.buf[4*x:4*x+4], c[:])
+		}
+	default:
+		for x := 0; x < w; x++ {
+			c := color.NRGBAModel.Convert(r.img.At(r.b.Min.X+x, y)).(color.NRGBA)
+			r.buf[4*x], r.buf[4*x+1], r.buf[4*x+2], r.buf[4*x+3] = c.R, c.G, c.B, c.A
+		}
+	}
+
+	return r.buf
+}
+
+// hashPixels computes the pixel checksum
+func (p *Packer) hashPixels(img image.Image) uint64 {
+	b := img.Bounds()
+
+	var dims [16]byte
+	binary.LittleEndian.PutUint64(dims[:8], uint64(b.Dx()))
+	binary.LittleEndian.PutUint64(dims[8:], uint64(b.Dy()))
+	h := crc64.Update(0, p.table, dims[:])
+
+	rows := newRowReader(img)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		h = crc64.Update(h, p.table, rows.row(y))
+	}
+
+	return h
+}
+
+// samePixels reports whether the images are the same
+func samePixels(i, j image.Image) bool {
+	bi, bj := i.Bounds(), j.Bounds()
+	if !bi.Size().Eq(bj.Size()) {
+		return false
+	}
+
+	ri, rj := newRowReader(i), newRowReader(j)
+	for y := 0; y < bi.Dy(); y++ {
+		if !bytes.Equal(ri.row(bi.Min.Y+y), rj.row(bj.Min.Y+y)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// comparePixels compares the image sizes and pixels
+func comparePixels(i, j image.Image) int {
+	bi, bj := i.Bounds(), j.Bounds()
+	if bi.Dx() != bj.Dx() {
+		return bi.Dx() - bj.Dx()
+	}
+	if bi.Dy() != bj.Dy() {
+		return bi.Dy() - bj.Dy()
+	}
+
+	ri, rj := newRowReader(i), newRowReader(j)
+	for y := 0; y < bi.Dy(); y++ {
+		if c := bytes.Compare(ri.row(bi.Min.Y+y), rj.row(bj.Min.Y+y)); c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,232 @@
+package packer
+
+import (
+	"fmt"
+	"image"
+	"strings"
+)
+
+// Result is the last Pack report
+type Result struct {
+	// Frames describes the placement of the images in the OutputImages
+	Frames []*Frame
+	// Animations groups the Frames of the images named as the sequences
+	Animations []*Animation
+	// TileMaps holds the tile maps added by the AddTileMap
+	TileMaps []*TileMap
+	// Variants holds the atlas sets packed for the configured Scales
+	Variants []*Variant
+	// Unplaced lists the images that could not be placed, including the
+	// images that could not be placed in the Variants
+	Unplaced []*UnplacedImage
+	// Dropped lists the images left out by the OverflowDrop policy
+	Dropped []*InputImage
+	// Downscaled lists the images downscaled by the OverflowDownscale policy
+	Downscaled []*DownscaledImage
+
+	// Merged lists the images stored in the region of another image
+	Merged []*MergedImage
+	// MaxError is the maximum per channel difference (0-255) of the merged
+	// images from the images they are merged into
+	MaxError int
+}
+
+// MergedImage describes the merged image
+type MergedImage struct {
+	Image *InputImage
+	Into  *InputImage
+	// Error is the maximum per channel difference (0-255) from the Into image
+	Error int
+	// Distance is the perceptual hash distance from the Into image
+	Distance int
+	// Transform is the transform of the Into image drawing the image
+	Transform Transform
+}
+
+// DownscaledImage describes the downscaled image
+type DownscaledImage struct {
+	Image *InputImage
+	Scale float64
+}
+
+// UnplacedImage describes the unplaced image
+type UnplacedImage struct {
+	Image *InputImage
+	// Err is the reason, the *ImageTooLargeError when the image does not
+	// fit the page, the ErrMaxSizeExceeded when the images exceed the
+	// maximum page or the context error when the Pack is canceled
+	Err error
+}
+
+// UnplacedError is the Strict mode error
+type UnplacedError struct {
+	Images []*UnplacedImage
+}
+
+func (e *UnplacedError) Error() string {
+	msgs := make([]string, len(e.Images))
+	for i, u := range e.Images {
+		msgs[i] = fmt.Sprintf("%q: %s", u.Image.Name, u.Err)
+	}
+	return fmt.Sprintf("%d images could not be placed: %s", len(e.Images), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the unplaced reasons
+func (e *UnplacedError) Unwrap() []error {
+	errs := make([]error, len(e.Images))
+	for i, u := range e.Images {
+		errs[i] = u.Err
+	}
+	return errs
+}
+
+// unplacedImages lists the unplaced images, err is the default reason
+func (p *Packer) unplacedImages(err error) []*UnplacedImage {
+	var images []*UnplacedImage
+	for _, img := range p.images.inputImages {
+		if img.Placed() || img.dropped {
+			continue
+		}
+
+		reason := img.unplacedErr
+		if img.duplicatedID != nil && p.cfg.Merge {
+			reason = p.find(*img.duplicatedID).unplacedErr
+		}
+		if reason == nil {
+			reason = err
+		}
+		images = append(images, &UnplacedImage{Image: img, Err: reason})
+	}
+	return images
+}
+
+// Result returns the last Pack report
+func (p *Packer) Result() *Result {
+	return p.result
+}
+
+// Frame describes the image placement
+type Frame struct {
+	Image     *InputImage
+	TextureID int
+	// Rect is the region of the atlas holding the image content, its size
+	// is swapped when the content is Rotated
+	Rect    image.Rectangle
+	Rotated bool
+	// Direction is the direction the content of the Rotated frame is
+	// rotated by 90 degrees
+	Direction RotationDirection
+	// SourceSize is the size of the image before the trimming
+	SourceSize image.Point
+	Trim       Trim
+	// Scale is the scale of the image content, it is below 1 for the images
+	// downscaled by the OverflowDownscale policy, their SourceSize and Trim
+	// are scaled as well
+	Scale float64
+
+	// Pivot is the pivot normalized to the SourceSize
+	Pivot Pivot
+	// ContentPivot is the pivot in the pixels of the trimmed content before
+	// the rotation relative to its top left corner
+	ContentPivot Pivot
+	// AtlasPivot is the pivot in the pixels of the atlas
+	AtlasPivot Pivot
+
+	// NineSlice is the scale-9 layout scaled as the SourceSize
+	NineSlice *NineSlice
+	// Mesh is the polygon mesh of the content traced by the Mesh mode
+	Mesh *Mesh
+	// Transform is the transform of the content in the Rect drawing the
+	// image merged by the DedupTransforms, it is applied after the rotation
+	// of the content is reverted
+	Transform Transform
+}
+
+// Pivot is the image origin
+type Pivot struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// setPivot sets the pivot
+func (f *Frame) setPivot(pivot Pivot) {
+	f.Pivot = pivot
+	f.ContentPivot = Pivot{
+		X: pivot.X*float64(f.SourceSize.X) - float64(f.Trim.Left),
+		Y: pivot.Y*float64(f.SourceSize.Y) - float64(f.Trim.Top),
+	}
+
+	x, y := f.atlasPoint(f.ContentPivot.X, f.ContentPivot.Y)
+	f.AtlasPivot = Pivot{X: x, Y: y}
+}
+
+// atlasPoint transforms the content point to the atlas
+func (f *Frame) atlasPoint(x, y float64) (float64, float64) {
+	if f.Transform != TransformNone {
+		// the point of the content stored in the Rect
+		size := f.Rect.Size()
+		if f.Rotated {
+			size = image.Pt(size.Y, size.X)
+		}
+		w, h := float64(size.X), float64(size.Y)
+		if f.Transform.swapsAxes() {
+			w, h = h, w
+		}
+		x, y = f.Transform.inverse().point(x, y, w, h)
+	}
+
+	switch {
+	case f.Rotated && f.Direction == RotateCW:
+		x, y = float64(f.Rect.Dx())-y, x
+	case f.Rotated:
+		x, y = y, float64(f.Rect.Dy())-x
+	}
+	return float64(f.Rect.Min.X) + x, float64(f.Rect.Min.Y) + y
+}
+
+// frames describes the packed images
+func (p *Packer) frames() []*Frame {
+	var frames []*Frame
+	for _, img := range p.images.inputImages {
+		if !img.Placed() {
+			continue
+		}
+
+		// the merged image with the transform has the region of its duplicate
+		_, r := img.content()
+		if img.transform != TransformNone {
+			_, r = p.find(*img.duplicatedID).content()
+		}
+		size := r.Size()
+		if img.rotated {
+			size = image.Pt(size.Y, size.X)
+		}
+		pos := img.pos.Add(image.Pt(p.border.l+p.cfg.Extrude, p.border.t+p.cfg.Extrude))
+
+		frame := &Frame{
+			Image:      img,
+			TextureID:  img.textureID,
+			Rect:       image.Rectangle{pos, pos.Add(size)},
+			Rotated:    img.rotated,
+			Direction:  p.cfg.RotationDirection,
+			SourceSize: img.size.Size(),
+			Trim:       img.Trim(),
+			Scale:      img.scale(),
+			Transform:  img.transform,
+		}
+		if img.downscaled != nil {
+			frame.SourceSize = img.downscaled.source
+			frame.Trim = img.downscaled.trim
+		}
+		frame.setPivot(img.Pivot())
+		if img.nineSlice != nil {
+			frame.NineSlice = img.nineSlice.scaled(img.scale())
+		}
+		if p.cfg.Mesh != MeshNone {
+			src, r := img.content()
+			frame.setMesh(p, src, r, p.bins[img.textureID].Size())
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
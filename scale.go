@@ -0,0 +1,287 @@
+package packer
+
+import (
+	"errors"
+	"github.com/disintegration/imaging"
+	"image"
+	"math"
+)
+
+// ErrInvalidScale is an error thrown when the scale is not positive
+var ErrInvalidScale = errors.New("Invalid scale provided")
+
+// Variant is the atlas set packed at one of the Scales, the layout is
+// scaled when the images fit it or packed again otherwise
+type Variant struct {
+	Scale        float64
+	OutputImages []*OutputImage
+	Frames       []*Frame
+	// Unplaced lists the images that could not be placed at the scale, they
+	// are reported in the Result as well
+	Unplaced []*UnplacedImage
+}
+
+// scaledImage is the resampled image
+type scaledImage struct {
+	img       *InputImage
+	content   *image.NRGBA
+	source    image.Point
+	trim      Trim
+	pos       image.Point
+	textureID int
+	rotated   bool
+}
+
+// packVariant packs the variant
+func (p *Packer) packVariant(scale float64) (*Variant, error) {
+	v := &Variant{Scale: scale}
+	if scale <= 0 {
+		return nil, ErrInvalidScale
+	}
+
+	if scale == 1 {
+		v.OutputImages = p.OutputImages
+		v.Frames = p.result.Frames
+		return v, nil
+	}
+
+	var images []*scaledImage
+	byID := map[int]*scaledImage{}
+
+	for _, img := range p.images.inputImages {
+		if !img.Placed() || (img.duplicatedID != nil && p.cfg.Merge) {
+			continue
+		}
+
+		si := p.scaleImage(img, scale*img.scale())
+		images = append(images, si)
+		byID[img.id] = si
+
+		select {
+		case <-p.ctx.Done():
+			return nil, p.ctx.Err()
+		default:
+		}
+	}
+
+	bins := make([]image.Rectangle, len(p.bins))
+	for i, bin := range p.bins {
+		w, h := p.binSize(scaleUp(bin.Dx(), scale), scaleUp(bin.Dy(), scale))
+		bins[i] = image.Rect(0, 0, w, h)
+	}
+
+	if !p.layoutScaled(images, bins, scale) {
+		var err error
+		if bins, v.Unplaced, err = p.repackScaled(images, scale); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, bin := range bins {
+		v.OutputImages = append(v.OutputImages, &OutputImage{Image: image.NewRGBA(bin), ID: i})
+	}
+
+	for _, si := range images {
+		if !si.pos.Eq(unplaced) && si.textureID < len(v.OutputImages) {
+			p.drawImage(v.OutputImages[si.textureID].Image, si.content, si.content.Bounds(), si.pos, si.rotated)
+		}
+	}
+
+	for _, img := range p.images.inputImages {
+		leader := img
+		if img.duplicatedID != nil && p.cfg.Merge {
+			leader = p.find(*img.duplicatedID)
+		}
+		si, ok := byID[leader.id]
+		if !ok || si.pos.Eq(unplaced) {
+			continue
+		}
+
+		// the content of the merged image is the transformed content of
+		// its duplicate
+		var content image.Image = si.content
+		if img.transform != TransformNone {
+			content = img.transform.apply(si.content)
+		}
+
+		size := si.content.Bounds().Size()
+		trim := si.trim
+		source := si.source
+		if leader != img {
+			var r image.Rectangle
+			source, r = p.scaledContent(img, scale*img.scale())
+			own := content.Bounds().Size()
+			trim = Trim{
+				Left:   r.Min.X,
+				Top:    r.Min.Y,
+				Right:  max(0, source.X-r.Min.X-own.X),
+				Bottom: max(0, source.Y-r.Min.Y-own.Y),
+			}
+		}
+
+		if si.rotated {
+			size = image.Pt(size.Y, size.X)
+		}
+		pos := si.pos.Add(image.Pt(p.border.l+p.cfg.Extrude, p.border.t+p.cfg.Extrude))
+
+		frame := &Frame{
+			Image:      img,
+			TextureID:  si.textureID,
+			Rect:       image.Rectangle{pos, pos.Add(size)},
+			Rotated:    si.rotated,
+			Direction:  p.cfg.RotationDirection,
+			SourceSize: source,
+			Trim:       trim,
+			Scale:      img.scale(),
+			Transform:  img.transform,
+		}
+		frame.setPivot(img.Pivot())
+		if img.nineSlice != nil {
+			frame.NineSlice = img.nineSlice.scaled(scale * img.scale())
+		}
+		if p.cfg.Mesh != MeshNone {
+			frame.setMesh(p, content, content.Bounds(), bins[si.textureID].Size())
+		}
+		v.Frames = append(v.Frames, frame)
+	}
+
+	return v, nil
+}
+
+// scaledContent computes the scaled size and content
+func (p *Packer) scaledContent(img *InputImage, scale float64) (image.Point, image.Rectangle) {
+	size := img.size.Size()
+	source := image.Pt(scaleUp(size.X, scale), scaleUp(size.Y, scale))
+
+	r := img.source().Sub(img.size.Min)
+	r = image.Rect(
+		scaleDown(r.Min.X, scale),
+		scaleDown(r.Min.Y, scale),
+		min(scaleUp(r.Max.X, scale), source.X),
+		min(scaleUp(r.Max.Y, scale), source.Y),
+	)
+
+	return source, r
+}
+
+func (p *Packer) scaleImage(img *InputImage, scale float64) *scaledImage {
+	source, r := p.scaledContent(img, scale)
+	full := imaging.Resize(img.image, source.X, source.Y, p.cfg.ScaleFilter)
+
+	si := &scaledImage{
+		img:     img,
+		content: imaging.Crop(full, r),
+		source:  source,
+	}
+	if img.cropped {
+		si.trim = Trim{
+			Left:   r.Min.X,
+			Top:    r.Min.Y,
+			Right:  source.X - r.Max.X,
+			Bottom: source.Y - r.Max.Y,
+		}
+	}
+
+	return si
+}
+
+// layoutScaled scales the layout, false when the images do not fit
+func (p *Packer) layoutScaled(images []*scaledImage, bins []image.Rectangle, scale float64) bool {
+	padding := image.Pt(p.border.l+p.border.r+2*p.cfg.Extrude, p.border.t+p.border.b+2*p.cfg.Extrude)
+	placed := make([][]image.Rectangle, len(bins))
+
+	for _, si := range images {
+		if si.img.textureID >= len(bins) {
+			return false
+		}
+
+		size := si.content.Bounds().Size()
+		if si.img.rotated {
+			size = image.Pt(size.Y, size.X)
+		}
+		pos := image.Pt(scaleDown(si.img.pos.X, scale), scaleDown(si.img.pos.Y, scale))
+		r := image.Rectangle{pos, pos.Add(size).Add(padding)}
+		if a := p.cfg.Alignment; a > 1 {
+			if pos.X%a != 0 || pos.Y%a != 0 {
+				return false
+			}
+			r.Max = image.Pt(pos.X+roundUp(r.Dx(), a), pos.Y+roundUp(r.Dy(), a))
+		}
+
+		if !r.In(bins[si.img.textureID]) {
+			return false
+		}
+		for _, o := range placed[si.img.textureID] {
+			if o.Overlaps(r) {
+				return false
+			}
+		}
+		placed[si.img.textureID] = append(placed[si.img.textureID], r)
+
+		si.pos = pos
+		si.textureID = si.img.textureID
+		si.rotated = si.img.rotated
+	}
+
+	return true
+}
+
+// repackScaled packs the scaled images again
+func (p *Packer) repackScaled(images []*scaledImage, scale float64) ([]image.Rectangle, []*UnplacedImage, error) {
+	cfg := *p.cfg
+	cfg.Scales = nil
+	cfg.Crop = false
+	cfg.Merge = false
+	cfg.Dedup = DedupExact
+	cfg.TextureWidth = scaleUp(cfg.TextureWidth, scale)
+	cfg.TextureHeight = scaleUp(cfg.TextureHeight, scale)
+
+	child := newPacker(p.ctx, &cfg)
+	child.Ltr = p.Ltr
+	child.MinFillRate = p.MinFillRate
+
+	added := map[*InputImage]*scaledImage{}
+	for _, si := range images {
+		if si.content.Bounds().Empty() {
+			continue
+		}
+		in, err := child.AddImage(si.content)
+		if err != nil {
+			return nil, nil, err
+		}
+		added[in] = si
+	}
+
+	if err := child.pack(cfg.Heuristic, cfg.TextureWidth, cfg.TextureHeight); err != nil {
+		return nil, nil, err
+	}
+
+	for in, si := range added {
+		si.pos = in.pos
+		si.textureID = in.textureID
+		si.rotated = in.rotated
+	}
+
+	// the reasons are reported for the images of the packer
+	var unplacedImages []*UnplacedImage
+	for _, u := range child.unplacedImages(ErrNotPlaced) {
+		si := added[u.Image]
+		reason := u.Err
+		if e, ok := reason.(*ImageTooLargeError); ok {
+			reason = &ImageTooLargeError{Image: si.img, Name: si.img.Name, Size: e.Size, Max: e.Max}
+		}
+		unplacedImages = append(unplacedImages, &UnplacedImage{Image: si.img, Err: reason})
+	}
+
+	return child.bins, unplacedImages, nil
+}
+
+// scaleUp scales and rounds up, ignoring the float error
+func scaleUp(v int, scale float64) int {
+	return int(math.Ceil(float64(v)*scale - 1e-9))
+}
+
+// scaleDown scales and rounds down
+func scaleDown(v int, scale float64) int {
+	return int(math.Floor(float64(v)*scale + 1e-9))
+}
@@ -0,0 +1,154 @@
+package packer
+
+import (
+	"encoding/json"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultSequencePattern matches the names like walk_0001, walk-2 or walk3
+const DefaultSequencePattern = `^(.+?)[_\-.]?(\d+)(?:\.[A-Za-z]+)?$`
+
+// Animation is the frame sequence
+type Animation struct {
+	Name      string
+	Frames    []*Frame
+	Durations []time.Duration
+	Loop      LoopMode
+}
+
+// Timing overrides the animation timing, in JSON like
+// {"duration": 80, "durations": [200, 80], "loop": "pingpong"}
+type Timing struct {
+	// Duration is the duration of the frames
+	Duration time.Duration
+	// Durations are the durations of the first frames, they take precedence
+	// over the Duration
+	Durations []time.Duration
+	Loop      LoopMode
+}
+
+// UnmarshalJSON decodes the timing
+func (t *Timing) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Duration  float64   `json:"duration"`
+		Durations []float64 `json:"durations"`
+		Loop      LoopMode  `json:"loop"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	t.Duration = milliseconds(v.Duration)
+	t.Durations = nil
+	for _, d := range v.Durations {
+		t.Durations = append(t.Durations, milliseconds(d))
+	}
+	t.Loop = v.Loop
+	return nil
+}
+
+// SetTiming sets the animation timing
+func (p *Packer) SetTiming(animation string, t *Timing) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.timings == nil {
+		p.timings = map[string]*Timing{}
+	}
+	p.timings[animation] = t
+}
+
+// LoadTimings loads the timings by the animation names
+func (p *Packer) LoadTimings(r io.Reader) error {
+	var timings map[string]*Timing
+	if err := json.NewDecoder(r).Decode(&timings); err != nil {
+		return err
+	}
+	for name, t := range timings {
+		p.SetTiming(name, t)
+	}
+	return nil
+}
+
+// animations groups the frames, single frames are not animations
+func (p *Packer) animations() ([]*Animation, error) {
+	if p.cfg.SequencePattern == "" {
+		return nil, nil
+	}
+	pattern, err := regexp.Compile(p.cfg.SequencePattern)
+	if err != nil {
+		return nil, err
+	}
+
+	type sequenceFrame struct {
+		frame *Frame
+		index int
+	}
+	sequences := map[string][]sequenceFrame{}
+	var names []string
+
+	for _, frame := range p.result.Frames {
+		if frame.Image.tile {
+			continue
+		}
+		m := pattern.FindStringSubmatch(frame.Image.Name)
+		if len(m) < 3 {
+			continue
+		}
+		index, err := strconv.Atoi(m[2])
+		if err != nil {
+			continue
+		}
+		if _, ok := sequences[m[1]]; !ok {
+			names = append(names, m[1])
+		}
+		sequences[m[1]] = append(sequences[m[1]], sequenceFrame{frame, index})
+	}
+	sort.Strings(names)
+
+	var animations []*Animation
+	for _, name := range names {
+		frames := sequences[name]
+		if len(frames) < 2 {
+			continue
+		}
+		sort.SliceStable(frames, func(i, j int) bool {
+			if frames[i].index != frames[j].index {
+				return frames[i].index < frames[j].index
+			}
+			return frames[i].frame.Image.Name < frames[j].frame.Image.Name
+		})
+
+		timing := p.timings[name]
+		a := &Animation{Name: name}
+		if timing != nil {
+			a.Loop = timing.Loop
+		}
+
+		for i, f := range frames {
+			d := f.frame.Image.Duration
+			switch {
+			case timing != nil && i < len(timing.Durations):
+				d = timing.Durations[i]
+			case timing != nil && timing.Duration != 0:
+				d = timing.Duration
+			case d == 0:
+				d = p.cfg.FrameDuration
+			}
+
+			a.Frames = append(a.Frames, f.frame)
+			a.Durations = append(a.Durations, d)
+		}
+		animations = append(animations, a)
+	}
+
+	return animations, nil
+}
+
+func milliseconds(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
@@ -0,0 +1,86 @@
+package packer
+
+import (
+	"image"
+	"sort"
+)
+
+// fitLastBin packs the last bin again into the smallest eighth size
+func (p *Packer) fitLastBin(heur Heuristic) error {
+	index := len(p.bins) - 1
+	if index < 0 || p.missingImages != 0 {
+		return nil
+	}
+	bin := p.bins[index]
+
+	var used int
+	for _, img := range p.images.inputImages {
+		if img.textureID == index && img.Placed() {
+			used += img.sizeCurrent.Dx() * img.sizeCurrent.Dy()
+		}
+	}
+
+	var sizes []image.Point
+	seen := map[image.Point]bool{}
+	for kx := 1; kx <= 8; kx++ {
+		for ky := 1; ky <= 8; ky++ {
+			if p.cfg.Square && kx != ky {
+				continue
+			}
+			w, h := p.binSize(bin.Dx()*kx/8, bin.Dy()*ky/8)
+			size := image.Pt(w, h)
+			if seen[size] || w*h < used || w*h >= bin.Dx()*bin.Dy() || w > bin.Dx() || h > bin.Dy() {
+				continue
+			}
+			seen[size] = true
+			sizes = append(sizes, size)
+		}
+	}
+	sort.SliceStable(sizes, func(i, j int) bool {
+		return sizes[i].X*sizes[i].Y < sizes[j].X*sizes[j].Y
+	})
+
+	for _, size := range sizes {
+		last := p.saveState()
+
+		p.bins = p.bins[:index]
+		p.clearBin(index)
+		p.bins = append(p.bins, image.Rect(0, 0, size.X, size.Y))
+
+		p.missingImages = 0
+		if _, err := p.fillBin(heur, size.X, size.Y, index); err != nil {
+			return err
+		}
+		if p.missingImages == 0 {
+			return nil
+		}
+
+		p.restoreState(last)
+		p.missingImages = 0
+	}
+
+	return nil
+}
+
+// shrinkBins shrinks the bins to their images
+func (p *Packer) shrinkBins() {
+	used := make([]image.Rectangle, len(p.bins))
+	for _, img := range p.images.inputImages {
+		if img.textureID >= len(p.bins) || !img.Placed() {
+			continue
+		}
+		r := image.Rectangle{img.pos, img.pos.Add(img.sizeCurrent.Size())}
+		used[img.textureID] = used[img.textureID].Union(r)
+	}
+
+	for i, bin := range p.bins {
+		w, h := p.binSize(max(used[i].Max.X, 1), max(used[i].Max.Y, 1))
+		if p.cfg.Square {
+			w = max(w, h)
+			h = w
+		}
+		if w <= bin.Dx() && h <= bin.Dy() {
+			p.bins[i] = image.Rect(0, 0, w, h)
+		}
+	}
+}
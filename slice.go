@@ -0,0 +1,157 @@
+package packer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/disintegration/imaging"
+	"image"
+	"sort"
+)
+
+// ErrInvalidGrid is an error thrown when the cell size is not positive
+var ErrInvalidGrid = errors.New("Invalid grid cell size provided")
+
+// Grid defines the AddGrid cells
+type Grid struct {
+	CellWidth, CellHeight int
+	// Margin is the space around the cells
+	Margin int
+	// Spacing is the space between the cells
+	Spacing int
+	// Count limits the number of the cells, zero cuts all the whole cells
+	Count int
+	// SkipEmpty skips the cells trimmed away completely
+	SkipEmpty bool
+}
+
+// Islands defines the AddIslands detection
+type Islands struct {
+	// Gap merges the islands closer than the gap, like the detached shadow
+	Gap int
+	// MinSize drops the islands smaller than the size in both dimensions
+	MinSize int
+}
+
+// AddGrid adds the grid cells as the images name_000, name_001...
+func (p *Packer) AddGrid(sheet image.Image, name string, grid Grid) ([]*InputImage, error) {
+	if grid.CellWidth <= 0 || grid.CellHeight <= 0 {
+		return nil, ErrInvalidGrid
+	}
+
+	b := sheet.Bounds()
+	var cells []image.Rectangle
+
+rows:
+	for y := b.Min.Y + grid.Margin; y+grid.CellHeight <= b.Max.Y-grid.Margin; y += grid.CellHeight + grid.Spacing {
+		for x := b.Min.X + grid.Margin; x+grid.CellWidth <= b.Max.X-grid.Margin; x += grid.CellWidth + grid.Spacing {
+			if grid.Count > 0 && len(cells) == grid.Count {
+				break rows
+			}
+			cells = append(cells, image.Rect(x, y, x+grid.CellWidth, y+grid.CellHeight))
+		}
+	}
+
+	return p.addSlices(sheet, name, cells, grid.SkipEmpty)
+}
+
+// AddIslands adds the connected sprites as the images name_000, name_001...
+func (p *Packer) AddIslands(sheet image.Image, name string, islands Islands) ([]*InputImage, error) {
+	b := sheet.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	keep := p.trimFunc(sheet)
+	rows := newRowReader(sheet)
+	mask := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		row := rows.row(b.Min.Y + y)
+		for x := 0; x < w; x++ {
+			mask[y*w+x] = keep(row[4*x : 4*x+4])
+		}
+	}
+
+	// the bounding boxes of the 8-connected regions
+	var rects []image.Rectangle
+	var stack []int
+	for start := range mask {
+		if !mask[start] {
+			continue
+		}
+		mask[start] = false
+		stack = append(stack[:0], start)
+		r := image.Rect(start%w, start/w, start%w+1, start/w+1)
+
+		for len(stack) != 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x, y := i%w, i/w
+			r = r.Union(image.Rect(x, y, x+1, y+1))
+
+			for ny := max(y-1, 0); ny <= min(y+1, h-1); ny++ {
+				for nx := max(x-1, 0); nx <= min(x+1, w-1); nx++ {
+					if n := ny*w + nx; mask[n] {
+						mask[n] = false
+						stack = append(stack, n)
+					}
+				}
+			}
+		}
+		rects = append(rects, r.Add(b.Min))
+	}
+
+	rects = mergeIslands(rects, islands.Gap)
+
+	cells := rects[:0]
+	for _, r := range rects {
+		if r.Dx() >= islands.MinSize || r.Dy() >= islands.MinSize {
+			cells = append(cells, r)
+		}
+	}
+	sort.SliceStable(cells, func(i, j int) bool {
+		if cells[i].Min.Y != cells[j].Min.Y {
+			return cells[i].Min.Y < cells[j].Min.Y
+		}
+		return cells[i].Min.X < cells[j].Min.X
+	})
+
+	return p.addSlices(sheet, name, cells, false)
+}
+
+// mergeIslands merges the rectangles closer than the gap
+func mergeIslands(rects []image.Rectangle, gap int) []image.Rectangle {
+	for merged := true; merged; {
+		merged = false
+		for i := 0; i < len(rects); i++ {
+			for j := i + 1; j < len(rects); j++ {
+				if !rects[i].Inset(-gap).Overlaps(rects[j]) {
+					continue
+				}
+				rects[i] = rects[i].Union(rects[j])
+				rects = append(rects[:j], rects[j+1:]...)
+				merged = true
+				j = i
+			}
+		}
+	}
+	return rects
+}
+
+// addSlices adds the sheet regions
+func (p *Packer) addSlices(sheet image.Image, name string, cells []image.Rectangle, skipEmpty bool) ([]*InputImage, error) {
+	var images []*InputImage
+	for i, r := range cells {
+		in, err := p.newInputImage(imaging.Crop(sheet, r), 0)
+		if err != nil {
+			return nil, err
+		}
+		if skipEmpty && in.crop.Empty() {
+			continue
+		}
+
+		in.Name = fmt.Sprintf("%s_%03d", name, i)
+		in.offset = r.Min.Sub(sheet.Bounds().Min)
+		images = append(images, in)
+	}
+
+	p.appendImage(images...)
+	return images, nil
+}
@@ -0,0 +1,155 @@
+package packer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+)
+
+// ErrInvalidTile is an error thrown when the tile size is not positive
+var ErrInvalidTile = errors.New("Invalid tile size provided")
+
+// TileMap is the image made of the shared tiles
+type TileMap struct {
+	Name string
+	// Columns and Rows are the number of the tiles of the image
+	Columns, Rows         int
+	TileWidth, TileHeight int
+	// Tiles holds the tile images by the rows, nil for the empty tiles
+	Tiles []*InputImage
+	// Frames holds the Frames of the Tiles in the Result
+	Frames []*Frame
+}
+
+// AddTileMap adds the new tiles of the image as name_000, name_001..., the
+// tiles are not trimmed and the transparent ones are left out
+func (p *Packer) AddTileMap(img image.Image, name string, tileWidth, tileHeight int) (*TileMap, error) {
+	if tileWidth <= 0 || tileHeight <= 0 {
+		return nil, ErrInvalidTile
+	}
+
+	b := img.Bounds()
+	m := &TileMap{
+		Name:       name,
+		Columns:    (b.Dx() + tileWidth - 1) / tileWidth,
+		Rows:       (b.Dy() + tileHeight - 1) / tileHeight,
+		TileWidth:  tileWidth,
+		TileHeight: tileHeight,
+	}
+
+	p.hlock.Lock()
+	defer p.hlock.Unlock()
+	if p.tiles == nil {
+		p.tiles = map[uint64][]*InputImage{}
+	}
+
+	var added []*InputImage
+	for y := 0; y < m.Rows; y++ {
+		for x := 0; x < m.Columns; x++ {
+			cell := image.Rect(x*tileWidth, y*tileHeight, (x+1)*tileWidth, (y+1)*tileHeight)
+			tile := image.NewNRGBA(image.Rect(0, 0, tileWidth, tileHeight))
+			draw.Draw(tile, tile.Bounds(), img, cell.Min.Add(b.Min), draw.Src)
+			if transparent(tile) {
+				m.Tiles = append(m.Tiles, nil)
+				continue
+			}
+
+			in, err := p.newInputImage(tile, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			if shared := p.findTile(in); shared != nil {
+				m.Tiles = append(m.Tiles, shared)
+				continue
+			}
+
+			in.Name = fmt.Sprintf("%s_%03d", name, len(m.Tiles))
+			in.crop = in.size
+			in.tile = true
+			p.tiles[in.hash] = append(p.tiles[in.hash], in)
+			m.Tiles = append(m.Tiles, in)
+			added = append(added, in)
+		}
+	}
+
+	p.appendImage(added...)
+	p.tileMaps = append(p.tileMaps, m)
+	return m, nil
+}
+
+// transparent reports whether the tile is transparent
+func transparent(tile *image.NRGBA) bool {
+	for i := 3; i < len(tile.Pix); i += 4 {
+		if tile.Pix[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// findTile finds the same tile
+func (p *Packer) findTile(in *InputImage) *InputImage {
+	for _, t := range p.tiles[in.hash] {
+		if samePixels(t.image, in.image) {
+			return t
+		}
+	}
+	return nil
+}
+
+// resultTileMaps copies the tile maps with the Frames
+func (p *Packer) resultTileMaps() []*TileMap {
+	frames := map[*InputImage]*Frame{}
+	for _, f := range p.result.Frames {
+		frames[f.Image] = f
+	}
+
+	var maps []*TileMap
+	for _, m := range p.tileMaps {
+		c := *m
+		c.Frames = make([]*Frame, len(m.Tiles))
+		for i, t := range m.Tiles {
+			if t != nil {
+				c.Frames[i] = frames[t]
+			}
+		}
+		maps = append(maps, &c)
+	}
+	return maps
+}
+
+type jsonTileMap struct {
+	Name       string `json:"name"`
+	Columns    int    `json:"columns"`
+	Rows       int    `json:"rows"`
+	TileWidth  int    `json:"tileWidth"`
+	TileHeight int    `json:"tileHeight"`
+	// Tiles are the frame names of the tiles by the rows, the empty tiles
+	// are the empty strings
+	Tiles []string `json:"tiles"`
+}
+
+// WriteTileMap writes the tile frame names by the rows
+func (p *Packer) WriteTileMap(w io.Writer, m *TileMap) error {
+	out := &jsonTileMap{
+		Name:       m.Name,
+		Columns:    m.Columns,
+		Rows:       m.Rows,
+		TileWidth:  m.TileWidth,
+		TileHeight: m.TileHeight,
+		Tiles:      make([]string, len(m.Tiles)),
+	}
+	for i, t := range m.Tiles {
+		if t != nil {
+			out.Tiles[i] = frameName(t)
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
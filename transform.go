@@ -0,0 +1,124 @@
+package packer
+
+import (
+	"github.com/disintegration/imaging"
+	"image"
+	"math"
+)
+
+// transforms lists the DedupTransforms, the flips first
+var transforms = []Transform{
+	TransformFlipH,
+	TransformFlipV,
+	TransformRotate180,
+	TransformRotate90,
+	TransformRotate270,
+	TransformTranspose,
+	TransformTransverse,
+}
+
+// apply transforms the image
+func (t Transform) apply(img image.Image) *image.NRGBA {
+	switch t {
+	case TransformFlipH:
+		return imaging.FlipH(img)
+	case TransformFlipV:
+		return imaging.FlipV(img)
+	case TransformRotate90:
+		return imaging.Rotate90(img)
+	case TransformRotate180:
+		return imaging.Rotate180(img)
+	case TransformRotate270:
+		return imaging.Rotate270(img)
+	case TransformTranspose:
+		return imaging.Transpose(img)
+	case TransformTransverse:
+		return imaging.Transverse(img)
+	}
+	return imaging.Clone(img)
+}
+
+// inverse gets the inverse transform
+func (t Transform) inverse() Transform {
+	switch t {
+	case TransformRotate90:
+		return TransformRotate270
+	case TransformRotate270:
+		return TransformRotate90
+	}
+	return t
+}
+
+// swapsAxes reports whether the transform swaps the axes
+func (t Transform) swapsAxes() bool {
+	switch t {
+	case TransformRotate90, TransformRotate270, TransformTranspose, TransformTransverse:
+		return true
+	}
+	return false
+}
+
+// point transforms the point
+func (t Transform) point(x, y, w, h float64) (float64, float64) {
+	switch t {
+	case TransformFlipH:
+		return w - x, y
+	case TransformFlipV:
+		return x, h - y
+	case TransformRotate90:
+		return y, w - x
+	case TransformRotate180:
+		return w - x, h - y
+	case TransformRotate270:
+		return h - y, x
+	case TransformTranspose:
+		return y, x
+	case TransformTransverse:
+		return h - y, w - x
+	}
+	return x, y
+}
+
+// rect transforms the rectangle
+func (t Transform) rect(r image.Rectangle, size image.Point) image.Rectangle {
+	w, h := float64(size.X), float64(size.Y)
+	x0, y0 := t.point(float64(r.Min.X), float64(r.Min.Y), w, h)
+	x1, y1 := t.point(float64(r.Max.X), float64(r.Max.Y), w, h)
+	return image.Rect(int(math.Round(x0)), int(math.Round(y0)), int(math.Round(x1)), int(math.Round(y1)))
+}
+
+// transformedDuplicates finds the transformed duplicates
+type transformedDuplicates struct {
+	p *Packer
+	// byHash holds the stored images by the checksum of their pixels, the
+	// hashes of the images may be provided by the caller
+	byHash map[uint64][]*InputImage
+}
+
+func (p *Packer) newTransformedDuplicates() *transformedDuplicates {
+	return &transformedDuplicates{p: p, byHash: map[uint64][]*InputImage{}}
+}
+
+func (d *transformedDuplicates) add(i *InputImage) {
+	h := d.p.hashPixels(i.image)
+	d.byHash[h] = append(d.byHash[h], i)
+}
+
+// find finds the image the provided one is the transform of
+func (d *transformedDuplicates) find(i *InputImage) (*InputImage, Transform) {
+	size := i.size.Size()
+	crop := i.crop.Sub(i.size.Min)
+
+	for _, t := range transforms {
+		// the stored image is the inverse transform of the provided one
+		inv := t.inverse()
+		src := inv.apply(i.image)
+		for _, s := range d.byHash[d.p.hashPixels(src)] {
+			if s.crop.Sub(s.size.Min).Eq(inv.rect(crop, size)) && samePixels(s.image, src) {
+				return s, t
+			}
+		}
+	}
+
+	return nil, TransformNone
+}